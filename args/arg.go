@@ -1,6 +0,0 @@
-package args
-
-type Arg struct {
-	Name  string
-	Value string
-}
@@ -1,12 +1,63 @@
 package args
 
-import "fmt"
+import (
+	"fmt"
 
-func AssertArgsPresent(args map[string]Arg, nameList []string) error {
-	for _, name := range nameList {
-		_, ok := args[name]
-		if !ok {
-			return fmt.Errorf("required arg '%s' was not present in parsed args", name)
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/F0903/pdf_downloader_uge5/report_source"
+)
+
+func validateArgs(args *Args) error {
+	if args.Input == "" {
+		return fmt.Errorf("required flag --input was not provided")
+	}
+	if args.OutputDir == "" {
+		return fmt.Errorf("required flag --output was not provided")
+	}
+	if args.Concurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1, got %d", args.Concurrency)
+	}
+	if args.MaxAttempts < 1 {
+		return fmt.Errorf("--max-attempts must be at least 1, got %d", args.MaxAttempts)
+	}
+	if args.RetryDelay < 0 || args.MaxRetryDelay < 0 || args.HostDelay < 0 {
+		return fmt.Errorf("delays can not be negative")
+	}
+	if args.RetryJitter < 0 || args.RetryJitter > 1 {
+		return fmt.Errorf("--retry-jitter must be between 0 and 1, got %v", args.RetryJitter)
+	}
+	if args.HostConnections < 0 {
+		return fmt.Errorf("--host-connections can not be negative, got %d", args.HostConnections)
+	}
+
+	if args.MinSize > 0 && args.MaxSize > 0 && args.MinSize > args.MaxSize {
+		return fmt.Errorf("--min-size can not be larger than --max-size")
+	}
+
+	if _, err := report_source.ParseDelimiter(args.Delimiter); err != nil {
+		return fmt.Errorf("invalid --delimiter: %w", err)
+	}
+
+	if err := report_source.ValidateEncoding(args.Encoding); err != nil {
+		return fmt.Errorf("invalid --encoding: %w", err)
+	}
+
+	if _, err := report_downloader.ParseFilenameTemplate(args.Filename); err != nil {
+		return fmt.Errorf("invalid --filename: %w", err)
+	}
+
+	if args.Resume && args.Journal == "" {
+		return fmt.Errorf("--resume needs the --journal of the earlier run")
+	}
+
+	if args.AnnotateInput {
+		format := args.Format
+		if format == report_source.FormatAuto {
+			// An unknown extension is reported when the input is read
+			format, _ = report_source.DetectFormat(args.Input)
+		}
+		if format != report_source.FormatExcel && format != report_source.FormatAuto {
+			return fmt.Errorf("--annotate-input only works with xlsx input, got %s", format)
 		}
 	}
 
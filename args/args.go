@@ -2,73 +2,321 @@ package args
 
 import (
 	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"slices"
 	"strings"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/column_mapping"
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/F0903/pdf_downloader_uge5/report_source"
+	"github.com/F0903/pdf_downloader_uge5/result_writer"
 )
 
-var ErrorNoArgs = errors.New("no arguments provided")
-var ErrorInvalidArg = errors.New("invalid arg, must specify argument as name=\"value\"")
+// Returned when the user asked for the usage text. It has already been printed at that point.
+var ErrorHelpRequested = flag.ErrHelp
 
-func parseArg(argString string) (*Arg, error) {
-	const seperator = '='
-	const delimiter = ' '
+const programName = "pdf_downloader"
 
-	argNameBuf := strings.Builder{}
-	argValueBuf := strings.Builder{}
+// Where each setting came from, in order of increasing precedence
+const (
+	sourceDefault     = "default"
+	sourceConfigFile  = "config file"
+	sourceEnvironment = "environment"
+	sourceCommandLine = "command line"
+)
 
-	parsingValue := false
-	for _, argChar := range argString {
+// All the settings that can be given on the command line, in environment variables or in a config file.
+type Args struct {
+	Input         string
+	OutputDir     string
+	AnnotateInput bool
+	ResultFormats []result_writer.Format
+	Journal       string
+	Resume        bool
 
-		if argChar == delimiter {
-			break
-		}
+	Concurrency     int
+	MaxAttempts     int
+	RetryDelay      time.Duration
+	MaxRetryDelay   time.Duration
+	RetryJitter     float64
+	RetryStatuses   []int
+	HostConnections int
+	HostDelay       time.Duration
+	HostLimits      map[string]downloader.HostLimits
+	Headers         http.Header
+	Incremental     report_downloader.IncrementalMode
+	QuarantineDir   string
+	Filename        string
+	DuplicateIds    report_downloader.DuplicatePolicy
+	Dedupe          report_downloader.DedupeMode
+	MinSize         int64
+	MaxSize         int64
+	Columns         *column_mapping.ColumnMapping
+	URLSeparator    string
+	Format          report_source.Format
+	Delimiter       string
+	Encoding        string
 
-		if argChar == seperator {
-			parsingValue = true
-			continue
-		}
+	ConfigPath  string
+	NoWait      bool
+	ShowVersion bool
+	PrintConfig bool
 
-		if parsingValue {
-			argValueBuf.WriteRune(argChar)
-		} else {
-			argNameBuf.WriteRune(argChar)
-		}
+	// The flag set the args were parsed with, and where each value came from, so we can print the effective config.
+	flags   *flag.FlagSet
+	sources map[string]string
+}
+
+func defaultArgs() *Args {
+	retryPolicy := downloader.DefaultRetryPolicy()
+	hostLimits := downloader.DefaultHostLimits()
+	return &Args{
+		Concurrency:     report_downloader.DefaultConcurrency,
+		MaxAttempts:     retryPolicy.MaxAttempts,
+		RetryDelay:      retryPolicy.BaseDelay,
+		MaxRetryDelay:   retryPolicy.MaxDelay,
+		RetryJitter:     retryPolicy.Jitter,
+		RetryStatuses:   retryPolicy.RetryableStatusCodes,
+		HostConnections: hostLimits.MaxConnections,
+		HostDelay:       hostLimits.MinDelay,
+		HostLimits:      map[string]downloader.HostLimits{},
+		Headers:         http.Header{},
+		Incremental:     report_downloader.IncrementalOff,
+		Filename:        report_downloader.DefaultFilenameTemplate,
+		Columns:         column_mapping.DefaultColumnMapping(),
+		Format:          report_source.FormatAuto,
+		Encoding:        "utf-8",
+		ResultFormats:   []result_writer.Format{result_writer.FormatExcel},
+		Journal:         result_writer.DefaultJournalName,
 	}
+}
+
+// These only make sense on the command line, so they can't be set from a config file or the environment.
+var commandLineOnlyFlags = []string{"config", "version", "print-config"}
+
+func newFlagSet(args *Args) *flag.FlagSet {
+	fs := flag.NewFlagSet(programName, flag.ContinueOnError)
+	// We print errors and usage ourselves
+	fs.SetOutput(io.Discard)
 
-	parsedArgName := argNameBuf.String()
-	parsedArgValue := argValueBuf.String()
+	fs.StringVar(&args.Input, "input", args.Input, "the `spreadsheet` of reports to download (required)")
+	fs.Var(formatValue{&args.Format}, "format", "the `format` of the input: auto, xlsx, csv, tsv, jsonl or json, where auto goes by the file extension")
+	fs.StringVar(&args.Delimiter, "delimiter", args.Delimiter, "the field `delimiter` for CSV and TSV input, \"tab\" for tabs (default , for CSV and tab for TSV)")
+	fs.StringVar(&args.Encoding, "encoding", args.Encoding, "the text `encoding` of CSV, TSV and JSON input: utf-8, utf-16, utf-16le, utf-16be, windows-1252 or latin1")
+	fs.StringVar(&args.OutputDir, "output", args.OutputDir, "the `directory` to download the reports to (required)")
+	fs.Var(&resultFormatsValue{formats: &args.ResultFormats}, "result-format", "the `formats` to write the results in, comma separated: xlsx, json, jsonl or csv (can be repeated)")
+	fs.StringVar(&args.Journal, "journal", args.Journal, "the `file` each result is written to as soon as it's done, relative to the output directory, or \"\" to not write one")
+	fs.BoolVar(&args.Resume, "resume", args.Resume, "continue an interrupted run, skipping the reports the journal says are done")
+	fs.BoolVar(&args.AnnotateInput, "annotate-input", args.AnnotateInput, "also write a copy of the input spreadsheet to the output directory, with the download results added to each row (xlsx input only)")
 
-	// Strip the " off of each end
-	parsedArgValue = parsedArgValue[1 : len(parsedArgValue)-1]
+	fs.IntVar(&args.Concurrency, "concurrency", args.Concurrency, "how many reports are downloaded at the same time")
+	fs.IntVar(&args.MaxAttempts, "max-attempts", args.MaxAttempts, "how many times each URL is tried before moving on to the next one")
+	fs.DurationVar(&args.RetryDelay, "retry-delay", args.RetryDelay, "the delay before the first retry, doubled for each retry after that")
+	fs.DurationVar(&args.MaxRetryDelay, "max-retry-delay", args.MaxRetryDelay, "the longest to wait between retries, 0 for no limit")
+	fs.Float64Var(&args.RetryJitter, "retry-jitter", args.RetryJitter, "the `fraction` (0-1) of each retry delay that is randomly added or subtracted, so retries don't all line up")
+	fs.Var(&retryStatusesValue{statuses: &args.RetryStatuses}, "retry-status", "the HTTP `statuses` that are retried, comma separated (can be repeated)")
+	fs.IntVar(&args.HostConnections, "host-connections", args.HostConnections, "how many requests can be made to the same host at the same time, 0 for no limit")
+	fs.DurationVar(&args.HostDelay, "host-delay", args.HostDelay, "the minimum time between two requests to the same host")
+	fs.Var(hostLimitsValue(args.HostLimits), "host-limits", "comma separated per-domain overrides of the host limits, each as `domain:connections:delay` (can be repeated)")
+	fs.Var(headersValue(args.Headers), "header", "an extra HTTP `header` to send with every request, as 'Name: value' (can be repeated)")
+	fs.Var(incrementalValue{&args.Incremental}, "incremental", "what to do with reports already in the output directory, the `mode` is off, skip or revalidate")
+	fs.Var(args.Columns, "columns", "which `columns` to read each report field from, as field=column,... where field is id, name, primary, fallback, year, expected_sha256, expected_size or url, and column is the header text or column letter (can be repeated)")
+	fs.StringVar(&args.URLSeparator, "url-separator", args.URLSeparator, "split each URL cell into several URLs by this `separator`, e.g. ;")
+	fs.StringVar(&args.Filename, "filename", args.Filename, "the `template` for where each report is saved in the output directory, using {id}, {name} and {year}, e.g. {year}/{id}.pdf")
+	fs.Var(duplicatePolicyValue{&args.DuplicateIds}, "duplicate-ids", "what to do with reports that have the same ID, the `policy` is fail, keep-first, keep-last or suffix")
+	fs.Var(dedupeModeValue{&args.Dedupe}, "dedupe", "what to do with reports that have the same content as another, the `mode` is off, hardlink, symlink or reference")
+	fs.Var(sizeValue{&args.MinSize}, "min-size", "the `size` a document must at least be, e.g. 2KB, or 0 for no limit")
+	fs.Var(sizeValue{&args.MaxSize}, "max-size", "the `size` a document can at most be, e.g. 500MB, or 0 for no limit")
+	fs.StringVar(&args.QuarantineDir, "quarantine-dir", args.QuarantineDir, "the `directory` to move downloads that fail validation to, instead of deleting them")
 
-	if parsedArgName == "" || parsedArgValue == "" {
-		return nil, ErrorInvalidArg
+	fs.StringVar(&args.ConfigPath, "config", args.ConfigPath, "a YAML, JSON or TOML config `file` with the values of any of these flags")
+	fs.BoolVar(&args.NoWait, "no-wait", args.NoWait, "exit right away instead of waiting for Enter when done")
+	fs.BoolVar(&args.ShowVersion, "version", args.ShowVersion, "print the version and exit")
+	fs.BoolVar(&args.PrintConfig, "print-config", args.PrintConfig, "print the effective configuration and exit")
+
+	return fs
+}
+
+func isZeroDefault(value string) bool {
+	switch value {
+	case "", "0", "0s", "false":
+		return true
 	}
+	return false
+}
 
-	arg := &Arg{Name: parsedArgName, Value: parsedArgValue}
+// Writes the usage text, generated from the flag definitions.
+func PrintUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s --input <spreadsheet> --output <directory> [flags]\n", programName)
+	fmt.Fprintf(w, "       %s %s <directory>\n\nFlags:\n", programName, VerifyCommand)
 
-	return arg, nil
+	fs := newFlagSet(defaultArgs())
+	fs.VisitAll(func(f *flag.Flag) {
+		typeName, usage := flag.UnquoteUsage(f)
+		if typeName != "" {
+			typeName = " <" + typeName + ">"
+		}
+
+		fmt.Fprintf(w, "  --%s%s\n    \t%s", f.Name, typeName, usage)
+		if !isZeroDefault(f.DefValue) {
+			fmt.Fprintf(w, " (default %s)", f.DefValue)
+		}
+		fmt.Fprintln(w)
+	})
+
+	fmt.Fprintf(w, "\nEvery flag can also be set with an environment variable like %s, or in the config file.\n", envVarName("max-attempts"))
+	fmt.Fprintln(w, "The command line takes precedence over the environment, which takes precedence over the config file.")
+	fmt.Fprintln(w, "The legacy form name=\"value\" (e.g. input_data=\"data.xlsx\" output_dir=\"downloads\") is also accepted.")
+}
+
+// Implemented by flags that collect several values, where the values from one source replace the ones
+// from the sources before it, instead of being added to them. Like --result-format and --retry-status.
+type replacedPerSource interface {
+	startSource()
+}
+
+// Lets the flags know that the values after this come from a new source.
+func startSource(fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if value, ok := f.Value.(replacedPerSource); ok {
+			value.startSource()
+		}
+	})
 }
 
-// The worlds worst arg parser
-// Returns map that maps from arg_name -> Arg object
-func ParseArgs() (map[string]Arg, error) {
-	argStrings := os.Args[1:] // Skip the first arg (usually the path to the program)
-	argLen := len(argStrings)
+func applySettings(fs *flag.FlagSet, settings []setting, source string, sources map[string]string) error {
+	startSource(fs)
+	for _, setting := range settings {
+		if fs.Lookup(setting.name) == nil {
+			return fmt.Errorf("unknown setting '%s' in %s", setting.name, source)
+		}
+		if slices.Contains(commandLineOnlyFlags, setting.name) {
+			return fmt.Errorf("'%s' can only be given on the command line, not in %s", setting.name, source)
+		}
+
+		if err := fs.Set(setting.name, setting.value); err != nil {
+			return fmt.Errorf("invalid value '%s' for '%s' in %s: %w", setting.value, setting.name, source, err)
+		}
+		sources[setting.name] = source
+	}
+	return nil
+}
 
-	if argLen == 0 {
-		return nil, ErrorNoArgs
+// Parses the command line arguments (without the program path), along with the config file and environment.
+// Returns ErrorHelpRequested if the user asked for help, after printing the usage to w.
+func ParseArgs(argStrings []string, w io.Writer) (*Args, error) {
+	// The config file has the lowest precedence, so it has to be applied first,
+	// but we need to parse the command line to know where it is, and which flags the command line overrides.
+	commandLineArgs := defaultArgs()
+	commandLineFlags := newFlagSet(commandLineArgs)
+	argStrings = translateLegacyArgs(commandLineFlags, argStrings)
+	if err := commandLineFlags.Parse(argStrings); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			PrintUsage(w)
+			return nil, ErrorHelpRequested
+		}
+		return nil, err
 	}
 
-	args := make(map[string]Arg, 0)
-	for _, argString := range argStrings {
-		arg, err := parseArg(argString)
+	args := defaultArgs()
+	fs := newFlagSet(args)
+	sources := make(map[string]string)
+
+	configPath := commandLineArgs.ConfigPath
+	if configPath == "" {
+		configPath = os.Getenv(envVarName("config"))
+	}
+	if configPath != "" {
+		settings, err := loadConfigFile(configPath)
 		if err != nil {
 			return nil, err
 		}
+		if err := applySettings(fs, settings, sourceConfigFile, sources); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applySettings(fs, environmentSettings(fs), sourceEnvironment, sources); err != nil {
+		return nil, err
+	}
+
+	// Now the command line can override everything else. We already know it parses.
+	startSource(fs)
+	fs.Parse(argStrings)
+	commandLineFlags.Visit(func(f *flag.Flag) {
+		sources[f.Name] = sourceCommandLine
+	})
 
-		args[arg.Name] = *arg
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected argument '%s'", fs.Arg(0))
+	}
+
+	args.ConfigPath = configPath
+	args.flags = fs
+	args.sources = sources
+
+	// Printing the version or the config should work even when the rest is incomplete
+	if args.ShowVersion || args.PrintConfig {
+		return args, nil
+	}
+
+	if err := validateArgs(args); err != nil {
+		return nil, err
 	}
 
 	return args, nil
 }
+
+// Legacy names that don't just map to the new name with dashes instead of underscores
+var legacyArgNames = map[string]string{
+	"input_data": "input",
+	"output_dir": "output",
+}
+
+// Does the flag take the next arg as its value, like "--input data.xlsx" does?
+func takesSeparateValue(fs *flag.FlagSet, argString string) bool {
+	if !strings.HasPrefix(argString, "-") || strings.Contains(argString, "=") {
+		return false
+	}
+
+	f := fs.Lookup(strings.TrimLeft(argString, "-"))
+	if f == nil {
+		return false
+	}
+
+	boolFlag, isBool := f.Value.(interface{ IsBoolFlag() bool })
+	return !isBool || !boolFlag.IsBoolFlag()
+}
+
+// Translates args in the old name="value" form to --name=value, so our existing scripts keep working.
+func translateLegacyArgs(fs *flag.FlagSet, argStrings []string) []string {
+	translated := make([]string, 0, len(argStrings))
+	for i, argString := range argStrings {
+		name, value, isAssignment := strings.Cut(argString, "=")
+		isFlagValue := i > 0 && takesSeparateValue(fs, argStrings[i-1])
+		if isFlagValue || strings.HasPrefix(argString, "-") || !isAssignment || name == "" {
+			translated = append(translated, argString)
+			continue
+		}
+
+		if newName, ok := legacyArgNames[name]; ok {
+			name = newName
+		} else {
+			name = strings.ReplaceAll(name, "_", "-")
+		}
+
+		// Strip the " off of each end, if the shell didn't already do it for us
+		if len(value) >= 2 && strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+			value = value[1 : len(value)-1]
+		}
+
+		translated = append(translated, "--"+name+"="+value)
+	}
+	return translated
+}
@@ -0,0 +1,82 @@
+package args
+
+import (
+	"io"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/F0903/pdf_downloader_uge5/result_writer"
+)
+
+// Sets the environment variable for the test, or makes sure it isn't set if value is empty.
+func setEnvForTest(t *testing.T, name string, value string) {
+	t.Setenv(name, value)
+	if value == "" {
+		os.Unsetenv(name)
+	}
+}
+
+func TestResultFormatPrecedence(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      string
+		environment string
+		commandLine []string
+		expected    []result_writer.Format
+	}{
+		{"default", "", "", nil, []result_writer.Format{"xlsx"}},
+		{"config", "result-format: [json]\n", "", nil, []result_writer.Format{"json"}},
+		{"environment", "", "jsonl", nil, []result_writer.Format{"jsonl"}},
+		{"command line", "", "", []string{"--result-format", "csv"}, []result_writer.Format{"csv"}},
+		{"command line over config", "result-format: [json]\n", "", []string{"--result-format", "csv"}, []result_writer.Format{"csv"}},
+		{"command line over environment", "", "jsonl", []string{"--result-format", "csv"}, []result_writer.Format{"csv"}},
+		{"environment over config", "result-format: [json]\n", "jsonl", nil, []result_writer.Format{"jsonl"}},
+		{"command line over everything", "result-format: [json]\n", "jsonl", []string{"--result-format", "csv"}, []result_writer.Format{"csv"}},
+		{"repeated in the same source", "result-format: [json, csv]\n", "", nil, []result_writer.Format{"json", "csv"}},
+		{"repeated on the command line", "result-format: [json]\n", "", []string{"--result-format", "csv", "--result-format", "xlsx"}, []result_writer.Format{"csv", "xlsx"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setEnvForTest(t, envVarName("config"), "")
+			setEnvForTest(t, envVarName("result-format"), test.environment)
+
+			argStrings := []string{"--input", "in.xlsx", "--output", "out"}
+			if test.config != "" {
+				argStrings = append(argStrings, "--config", writeConfigFile(t, "config.yaml", test.config))
+			}
+			argStrings = append(argStrings, test.commandLine...)
+
+			args, err := ParseArgs(argStrings, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(args.ResultFormats, test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, args.ResultFormats)
+			}
+		})
+	}
+}
+
+func TestRetryStatusPrecedence(t *testing.T) {
+	setEnvForTest(t, envVarName("config"), "")
+	setEnvForTest(t, envVarName("retry-status"), "429")
+	config := writeConfigFile(t, "config.yaml", "retry-status: [500, 502]\n")
+
+	args, err := ParseArgs([]string{"--input", "in.xlsx", "--output", "out", "--config", config}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(args.RetryStatuses, []int{429}) {
+		t.Errorf("expected the environment to replace the config, got %v", args.RetryStatuses)
+	}
+
+	args, err = ParseArgs([]string{"--input", "in.xlsx", "--output", "out", "--config", config, "--retry-status", "503"}, io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(args.RetryStatuses, []int{503}) {
+		t.Errorf("expected the command line to replace the environment, got %v", args.RetryStatuses)
+	}
+}
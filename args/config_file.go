@@ -0,0 +1,94 @@
+package args
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// A single flag value from a config file or environment variable.
+type setting struct {
+	name  string
+	value string
+}
+
+// Loads a YAML, JSON or TOML config file, chosen by the file extension.
+// The keys are the flag names, with either dashes or underscores.
+// Lists become multiple values for the same flag, and maps become "key:value" values,
+// so headers and host limits can be written naturally.
+func loadConfigFile(path string) ([]setting, error) {
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	values := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(fileBytes, &values)
+	case ".json":
+		// Keep numbers as they were written, otherwise big ones become floats like 1e+06
+		decoder := json.NewDecoder(bytes.NewReader(fileBytes))
+		decoder.UseNumber()
+		err = decoder.Decode(&values)
+	case ".toml":
+		err = toml.Unmarshal(fileBytes, &values)
+	default:
+		return nil, fmt.Errorf("unsupported config file type '%s', must be .yaml, .yml, .json or .toml", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not parse config file '%s': %w", path, err)
+	}
+
+	// Sort the keys so the settings are applied in the same order every time
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	settings := make([]setting, 0, len(values))
+	for _, name := range names {
+		flagName := strings.ToLower(strings.ReplaceAll(name, "_", "-"))
+		for _, value := range flattenConfigValue(values[name]) {
+			settings = append(settings, setting{flagName, value})
+		}
+	}
+
+	return settings, nil
+}
+
+func flattenConfigValue(value interface{}) []string {
+	switch typedValue := value.(type) {
+	case []interface{}:
+		values := make([]string, 0, len(typedValue))
+		for _, element := range typedValue {
+			values = append(values, flattenConfigValue(element)...)
+		}
+		return values
+	case map[interface{}]interface{}: // This is what the YAML library gives us
+		converted := make(map[string]interface{}, len(typedValue))
+		for key, element := range typedValue {
+			converted[fmt.Sprint(key)] = element
+		}
+		return flattenConfigValue(converted)
+	case map[string]interface{}:
+		values := make([]string, 0, len(typedValue))
+		for key, element := range typedValue {
+			values = append(values, fmt.Sprintf("%s:%v", key, element))
+		}
+		slices.Sort(values)
+		return values
+	case float64:
+		return []string{strconv.FormatFloat(typedValue, 'f', -1, 64)}
+	}
+	return []string{fmt.Sprint(value)}
+}
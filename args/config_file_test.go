@@ -0,0 +1,58 @@
+package args
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLargeNumbersInConfigFiles(t *testing.T) {
+	configs := map[string]string{
+		"config.json": `{"max-size": 1000000, "min-size": 2000, "retry-jitter": 0.5}`,
+		"config.yaml": "max-size: 1000000\nmin-size: 2000\nretry-jitter: 0.5\n",
+		// 1e6 is a float in TOML
+		"config.toml": "max-size = 1e6\nmin-size = 2000\nretry-jitter = 0.5\n",
+	}
+
+	for name, content := range configs {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfigFile(t, name, content)
+			args, err := ParseArgs([]string{"--input", "in.xlsx", "--output", "out", "--config", path}, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if args.MaxSize != 1000000 {
+				t.Errorf("expected max-size 1000000, got %d", args.MaxSize)
+			}
+			if args.MinSize != 2000 {
+				t.Errorf("expected min-size 2000, got %d", args.MinSize)
+			}
+			if args.RetryJitter != 0.5 {
+				t.Errorf("expected retry-jitter 0.5, got %v", args.RetryJitter)
+			}
+		})
+	}
+}
+
+func TestCommandLineOnlyFlagsInConfigFiles(t *testing.T) {
+	for _, name := range commandLineOnlyFlags {
+		t.Run(name, func(t *testing.T) {
+			path := writeConfigFile(t, "config.yaml", name+": true\n")
+			_, err := ParseArgs([]string{"--input", "in.xlsx", "--output", "out", "--config", path}, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), "only be given on the command line") {
+				t.Errorf("expected '%s' to be rejected, got %v", name, err)
+			}
+		})
+	}
+}
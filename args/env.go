@@ -0,0 +1,32 @@
+package args
+
+import (
+	"flag"
+	"os"
+	"slices"
+	"strings"
+)
+
+const envVarPrefix = "PDF_DOWNLOADER_"
+
+// The environment variable for a flag, e.g. max-attempts -> PDF_DOWNLOADER_MAX_ATTEMPTS
+func envVarName(flagName string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Collects the flag values set in the environment.
+func environmentSettings(fs *flag.FlagSet) []setting {
+	settings := make([]setting, 0)
+	fs.VisitAll(func(f *flag.Flag) {
+		if slices.Contains(commandLineOnlyFlags, f.Name) {
+			return
+		}
+
+		value, ok := os.LookupEnv(envVarName(f.Name))
+		if !ok {
+			return
+		}
+		settings = append(settings, setting{f.Name, value})
+	})
+	return settings
+}
@@ -0,0 +1,252 @@
+package args
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/F0903/pdf_downloader_uge5/report_source"
+	"github.com/F0903/pdf_downloader_uge5/result_writer"
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+// Implemented by flags that can be given more than once, so we can print each value separately.
+type multiValue interface {
+	Values() []string
+}
+
+// Collects "Name: value" headers. Setting the same header again replaces it.
+type headersValue http.Header
+
+func (headers headersValue) Set(value string) error {
+	name, headerValue, ok := strings.Cut(value, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return fmt.Errorf("invalid header '%s', must be in the form 'Name: value'", value)
+	}
+
+	http.Header(headers).Set(name, strings.TrimSpace(headerValue))
+	return nil
+}
+
+func (headers headersValue) Values() []string {
+	values := make([]string, 0, len(headers))
+	for name, headerValues := range headers {
+		for _, headerValue := range headerValues {
+			values = append(values, name+": "+headerValue)
+		}
+	}
+	slices.Sort(values)
+	return values
+}
+
+func (headers headersValue) String() string {
+	return strings.Join(headers.Values(), ", ")
+}
+
+// Collects per-domain host limits. Later values for the same domain replace earlier ones.
+type hostLimitsValue map[string]downloader.HostLimits
+
+func (hostLimits hostLimitsValue) Set(value string) error {
+	overrides, err := downloader.ParseHostLimitOverrides(value)
+	if err != nil {
+		return err
+	}
+
+	for domain, limits := range overrides {
+		hostLimits[domain] = limits
+	}
+	return nil
+}
+
+func (hostLimits hostLimitsValue) Values() []string {
+	values := make([]string, 0, len(hostLimits))
+	for domain, limits := range hostLimits {
+		values = append(values, fmt.Sprintf("%s:%d:%s", domain, limits.MaxConnections, limits.MinDelay))
+	}
+	slices.Sort(values)
+	return values
+}
+
+func (hostLimits hostLimitsValue) String() string {
+	return strings.Join(hostLimits.Values(), ",")
+}
+
+// Collects the HTTP status codes to retry. The first value from each source replaces the default or the earlier source,
+// and the ones after that are added to it.
+type retryStatusesValue struct {
+	statuses *[]int
+	isSet    bool
+}
+
+func (value *retryStatusesValue) Set(statusesString string) error {
+	if !value.isSet {
+		*value.statuses = []int{}
+		value.isSet = true
+	}
+
+	for _, statusString := range strings.Split(statusesString, ",") {
+		statusString = strings.TrimSpace(statusString)
+		if statusString == "" {
+			continue
+		}
+		status, err := strconv.Atoi(statusString)
+		if err != nil || status < 100 || status > 599 {
+			return fmt.Errorf("invalid HTTP status code '%s'", statusString)
+		}
+		if !slices.Contains(*value.statuses, status) {
+			*value.statuses = append(*value.statuses, status)
+		}
+	}
+	return nil
+}
+
+func (value *retryStatusesValue) startSource() {
+	value.isSet = false
+}
+
+func (value *retryStatusesValue) Values() []string {
+	if value.statuses == nil {
+		return nil
+	}
+
+	values := make([]string, 0, len(*value.statuses))
+	for _, status := range *value.statuses {
+		values = append(values, strconv.Itoa(status))
+	}
+	return values
+}
+
+func (value *retryStatusesValue) String() string {
+	return strings.Join(value.Values(), ",")
+}
+
+type incrementalValue struct {
+	mode *report_downloader.IncrementalMode
+}
+
+func (value incrementalValue) Set(modeString string) (err error) {
+	*value.mode, err = report_downloader.ParseIncrementalMode(modeString)
+	return err
+}
+
+func (value incrementalValue) String() string {
+	if value.mode == nil {
+		return ""
+	}
+	return value.mode.String()
+}
+
+type duplicatePolicyValue struct {
+	policy *report_downloader.DuplicatePolicy
+}
+
+func (value duplicatePolicyValue) Set(policyString string) (err error) {
+	*value.policy, err = report_downloader.ParseDuplicatePolicy(policyString)
+	return err
+}
+
+func (value duplicatePolicyValue) String() string {
+	if value.policy == nil {
+		return ""
+	}
+	return value.policy.String()
+}
+
+type dedupeModeValue struct {
+	mode *report_downloader.DedupeMode
+}
+
+func (value dedupeModeValue) Set(modeString string) (err error) {
+	*value.mode, err = report_downloader.ParseDedupeMode(modeString)
+	return err
+}
+
+func (value dedupeModeValue) String() string {
+	if value.mode == nil {
+		return ""
+	}
+	return value.mode.String()
+}
+
+// A size in bytes, which can be given with a unit like MB or MiB.
+type sizeValue struct {
+	bytes *int64
+}
+
+func (value sizeValue) Set(sizeString string) (err error) {
+	*value.bytes, err = utils.ParseBytes(sizeString)
+	return err
+}
+
+func (value sizeValue) String() string {
+	if value.bytes == nil {
+		return ""
+	}
+	return utils.FormatBytesExact(*value.bytes)
+}
+
+type formatValue struct {
+	format *report_source.Format
+}
+
+func (value formatValue) Set(formatString string) (err error) {
+	*value.format, err = report_source.ParseFormat(formatString)
+	return err
+}
+
+func (value formatValue) String() string {
+	if value.format == nil {
+		return ""
+	}
+	return string(*value.format)
+}
+
+// Collects the result formats. The first value from each source replaces the default or the earlier source,
+// and the ones after that are added to it.
+type resultFormatsValue struct {
+	formats *[]result_writer.Format
+	isSet   bool
+}
+
+func (value *resultFormatsValue) Set(formatsString string) error {
+	if !value.isSet {
+		*value.formats = nil
+		value.isSet = true
+	}
+
+	for _, formatString := range strings.Split(formatsString, ",") {
+		format, err := result_writer.ParseFormat(strings.TrimSpace(formatString))
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(*value.formats, format) {
+			*value.formats = append(*value.formats, format)
+		}
+	}
+	return nil
+}
+
+func (value *resultFormatsValue) startSource() {
+	value.isSet = false
+}
+
+func (value *resultFormatsValue) Values() []string {
+	if value.formats == nil {
+		return nil
+	}
+
+	values := make([]string, 0, len(*value.formats))
+	for _, format := range *value.formats {
+		values = append(values, string(format))
+	}
+	return values
+}
+
+func (value *resultFormatsValue) String() string {
+	return strings.Join(value.Values(), ",")
+}
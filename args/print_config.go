@@ -0,0 +1,67 @@
+package args
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Writes the fully resolved configuration as YAML, with where each value came from as a comment.
+// The output can be used as a config file as is.
+func (args *Args) WriteEffectiveConfig(w io.Writer) {
+	fmt.Fprintln(w, "# Effective configuration (command line > environment > config file > defaults)")
+	if args.ConfigPath != "" {
+		fmt.Fprintf(w, "# Config file: %s\n", args.ConfigPath)
+	}
+
+	args.flags.VisitAll(func(f *flag.Flag) {
+		if slices.Contains(commandLineOnlyFlags, f.Name) {
+			return
+		}
+
+		source, ok := args.sources[f.Name]
+		if !ok {
+			source = sourceDefault
+		}
+
+		if multi, ok := f.Value.(multiValue); ok {
+			values := multi.Values()
+			if len(values) == 0 {
+				fmt.Fprintf(w, "%s: []  # %s\n", f.Name, source)
+				return
+			}
+
+			fmt.Fprintf(w, "%s:  # %s\n", f.Name, source)
+			for _, value := range values {
+				fmt.Fprintf(w, "  - %s\n", yamlScalar(value))
+			}
+			return
+		}
+
+		fmt.Fprintf(w, "%s: %s  # %s\n", f.Name, formatFlagValue(f.Value), source)
+	})
+}
+
+func formatFlagValue(value flag.Value) string {
+	// Numbers and booleans are written as is, so they don't end up quoted
+	if getter, ok := value.(flag.Getter); ok {
+		switch typedValue := getter.Get().(type) {
+		case int, bool:
+			return fmt.Sprint(typedValue)
+		}
+	}
+	return yamlScalar(value.String())
+}
+
+// Formats a value so it reads back as the same string, quoting it if needed.
+func yamlScalar(value string) string {
+	scalarBytes, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%q", value)
+	}
+	return strings.TrimSuffix(string(scalarBytes), "\n")
+}
@@ -0,0 +1,45 @@
+package args
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+)
+
+// The command that checks an output directory against its manifest, instead of downloading
+const VerifyCommand = "verify"
+
+type VerifyArgs struct {
+	Directory string
+}
+
+func printVerifyUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s %s <directory>\n\n", programName, VerifyCommand)
+	fmt.Fprintln(w, "Checks every file in an output directory against the SHA256SUMS or manifest.json written by an earlier run,")
+	fmt.Fprintln(w, "and lists the files that are missing, modified or not in the manifest.")
+}
+
+// Parses the arguments of the verify command (without the program path and the command itself).
+// Returns ErrorHelpRequested if the user asked for help, after printing the usage to w.
+func ParseVerifyArgs(argStrings []string, w io.Writer) (*VerifyArgs, error) {
+	fs := flag.NewFlagSet(programName+" "+VerifyCommand, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	if err := fs.Parse(argStrings); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printVerifyUsage(w)
+			return nil, ErrorHelpRequested
+		}
+		return nil, err
+	}
+
+	if fs.NArg() == 0 {
+		return nil, fmt.Errorf("the directory to verify was not provided")
+	}
+	if fs.NArg() > 1 {
+		return nil, fmt.Errorf("unexpected argument '%s'", fs.Arg(1))
+	}
+
+	return &VerifyArgs{Directory: fs.Arg(0)}, nil
+}
@@ -0,0 +1,298 @@
+package column_mapping
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/models"
+	"github.com/xuri/excelize/v2"
+)
+
+// The report fields that can be mapped to a column
+const (
+	IdField       = "id"
+	NameField     = "name"
+	PrimaryField  = "primary"
+	FallbackField = "fallback"
+	// Optional, for use in filename templates
+	YearField = "year"
+	// Optional, the published hash and size in bytes that the download is checked against
+	ExpectedSHA256Field = "expected_sha256"
+	ExpectedSizeField   = "expected_size"
+	// Can be mapped any number of times, for URLs to try after the primary and fallback ones
+	UrlField = "url"
+)
+
+// The fields mapped to a single column, in the order they are printed
+var singleFields = []string{IdField, NameField, PrimaryField, FallbackField, YearField, ExpectedSHA256Field, ExpectedSizeField}
+
+// The fields that download URLs are read from, in the order they are tried
+var urlFields = []string{PrimaryField, FallbackField}
+
+var columnLetterPattern = regexp.MustCompile(`^[A-Za-z]{1,3}$`)
+
+var sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// Maps report fields to columns, either by the text in the header row or by column letter.
+type ColumnMapping struct {
+	columns map[string]string
+	// The extra url columns, in order
+	urlColumns []string
+	// If set, each URL cell is split by this into several URLs
+	urlSeparator string
+}
+
+// The layout of the GRI spreadsheets we were originally given.
+func DefaultColumnMapping() *ColumnMapping {
+	return &ColumnMapping{
+		columns: map[string]string{
+			IdField:       "A",
+			NameField:     "C",
+			PrimaryField:  "AL",
+			FallbackField: "AM",
+		},
+	}
+}
+
+// Maps the fields in the spec, keeping the current column for fields not in it.
+// Each entry is field=column, or field:column. An empty column unmaps the field.
+// Each url entry adds another column to read URLs from, and an empty one removes them all.
+func (mapping *ColumnMapping) Set(spec string) error {
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		separator := "="
+		if !strings.Contains(entry, "=") {
+			separator = ":"
+		}
+
+		field, column, ok := strings.Cut(entry, separator)
+		field = strings.ToLower(strings.TrimSpace(field))
+		column = strings.TrimSpace(column)
+		if !ok || (field != UrlField && !slices.Contains(singleFields, field)) {
+			return fmt.Errorf("invalid column mapping '%s', must be field=column where field is one of %s or %s", entry, strings.Join(singleFields, ", "), UrlField)
+		}
+
+		if field != UrlField {
+			mapping.columns[field] = column
+		} else if column == "" {
+			mapping.urlColumns = nil
+		} else {
+			mapping.urlColumns = append(mapping.urlColumns, column)
+		}
+	}
+	return nil
+}
+
+// Sets the separator used to split a single cell into several URLs, e.g. ";". Empty means no splitting.
+func (mapping *ColumnMapping) SetURLSeparator(separator string) {
+	mapping.urlSeparator = separator
+}
+
+func (mapping *ColumnMapping) Values() []string {
+	values := make([]string, 0, len(singleFields)+len(mapping.urlColumns))
+	for _, field := range singleFields {
+		values = append(values, field+"="+mapping.columns[field])
+	}
+	for _, column := range mapping.urlColumns {
+		values = append(values, UrlField+"="+column)
+	}
+	return values
+}
+
+func (mapping *ColumnMapping) String() string {
+	if mapping == nil {
+		return ""
+	}
+	return strings.Join(mapping.Values(), ",")
+}
+
+// Finds the index of the column with the header text, preferring an exact match over one that ignores case.
+func findHeader(header []string, column string) (int, bool) {
+	for i, headerText := range header {
+		if strings.TrimSpace(headerText) == column {
+			return i, true
+		}
+	}
+	for i, headerText := range header {
+		if strings.EqualFold(strings.TrimSpace(headerText), column) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Finds the index of the column, first by header text, then as a column letter if allowed.
+func findColumn(header []string, column string, allowLetters bool) (int, error) {
+	if index, found := findHeader(header, column); found {
+		return index, nil
+	}
+
+	if allowLetters && columnLetterPattern.MatchString(column) {
+		columnNumber, err := excelize.ColumnNameToNumber(strings.ToUpper(column))
+		if err != nil {
+			return 0, err
+		}
+		return columnNumber - 1, nil
+	}
+
+	if !allowLetters && columnLetterPattern.MatchString(column) {
+		return 0, fmt.Errorf("no field named '%s' (column letters can only be used with spreadsheets and CSV files)", column)
+	}
+
+	return 0, fmt.Errorf("no column with header '%s' in the header row", column)
+}
+
+// Like findColumn, but sources like JSON have no column order, so there a column letter,
+// like the ones in the default mapping, means the header with the name of the field instead.
+func findFieldColumn(header []string, field string, column string, allowLetters bool) (int, error) {
+	if allowLetters || !columnLetterPattern.MatchString(column) {
+		return findColumn(header, column, allowLetters)
+	}
+
+	if index, found := findHeader(header, column); found {
+		return index, nil
+	}
+	if index, found := findHeader(header, field); found {
+		return index, nil
+	}
+	return 0, fmt.Errorf("no field named '%s' or '%s' (column letters can only be used with spreadsheets and CSV files)", column, field)
+}
+
+// Finds the column of each mapped field in the header row.
+func (mapping *ColumnMapping) Resolve(header []string) (*ResolvedColumns, error) {
+	return mapping.resolve(header, true)
+}
+
+// Like Resolve, but only matches header text, for sources like JSON where columns have no letters.
+func (mapping *ColumnMapping) ResolveNames(header []string) (*ResolvedColumns, error) {
+	return mapping.resolve(header, false)
+}
+
+func (mapping *ColumnMapping) resolve(header []string, allowLetters bool) (*ResolvedColumns, error) {
+	resolved := &ResolvedColumns{
+		indices:      make(map[string]int),
+		urlSeparator: mapping.urlSeparator,
+	}
+
+	for _, field := range singleFields {
+		column := mapping.columns[field]
+		if column == "" {
+			continue
+		}
+
+		index, err := findFieldColumn(header, field, column, allowLetters)
+		if err != nil {
+			return nil, fmt.Errorf("could not find column for field '%s': %w", field, err)
+		}
+		resolved.indices[field] = index
+
+		if slices.Contains(urlFields, field) {
+			resolved.urlIndices = append(resolved.urlIndices, index)
+		}
+	}
+
+	for _, column := range mapping.urlColumns {
+		index, err := findColumn(header, column, allowLetters)
+		if err != nil {
+			return nil, fmt.Errorf("could not find column for field '%s': %w", UrlField, err)
+		}
+		resolved.urlIndices = append(resolved.urlIndices, index)
+	}
+
+	return resolved, nil
+}
+
+// A column mapping matched against a specific header row.
+type ResolvedColumns struct {
+	indices map[string]int
+	// The columns to read URLs from, in order
+	urlIndices   []int
+	urlSeparator string
+}
+
+func (resolved *ResolvedColumns) cell(row []string, field string) string {
+	index, ok := resolved.indices[field]
+	if !ok {
+		return ""
+	}
+	return cellAt(row, index)
+}
+
+func cellAt(row []string, index int) string {
+	// Rows don't include empty cells at the end, so the index can be out of range
+	if index >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[index])
+}
+
+// Collects the URLs from every URL column, in order, without empty or repeated ones.
+func (resolved *ResolvedColumns) urls(row []string) []string {
+	urls := make([]string, 0, len(resolved.urlIndices))
+	for _, index := range resolved.urlIndices {
+		cellUrls := []string{cellAt(row, index)}
+		if resolved.urlSeparator != "" {
+			cellUrls = strings.Split(cellUrls[0], resolved.urlSeparator)
+		}
+
+		for _, url := range cellUrls {
+			url = strings.TrimSpace(url)
+			if url != "" && !slices.Contains(urls, url) {
+				urls = append(urls, url)
+			}
+		}
+	}
+	return urls
+}
+
+// Reads the expected hash, which is hex encoded, and can be prefixed with "sha256:" like in some package registries.
+func parseExpectedSHA256(cell string) (string, error) {
+	hash := strings.TrimSpace(strings.TrimPrefix(strings.ToLower(cell), "sha256:"))
+	if hash == "" {
+		return "", nil
+	}
+	if !sha256Pattern.MatchString(hash) {
+		return "", fmt.Errorf("invalid %s '%s', must be 64 hex characters", ExpectedSHA256Field, cell)
+	}
+	return hash, nil
+}
+
+// Reads the expected size in bytes. Spreadsheets often format big numbers with thousands separators, so those are ignored.
+func parseExpectedSize(cell string) (int64, error) {
+	digits := strings.NewReplacer(",", "", " ", "", "\u00a0", "").Replace(cell)
+	if digits == "" {
+		return 0, nil
+	}
+	size, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid %s '%s', must be a whole number of bytes", ExpectedSizeField, cell)
+	}
+	return size, nil
+}
+
+func (resolved *ResolvedColumns) CreateReport(row []string) (*models.Report, error) {
+	expectedSHA256, err := parseExpectedSHA256(resolved.cell(row, ExpectedSHA256Field))
+	if err != nil {
+		return nil, err
+	}
+	expectedSize, err := parseExpectedSize(resolved.cell(row, ExpectedSizeField))
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Report{
+		Id:             resolved.cell(row, IdField),
+		Name:           resolved.cell(row, NameField),
+		Year:           resolved.cell(row, YearField),
+		DownloadLinks:  resolved.urls(row),
+		ExpectedSHA256: expectedSHA256,
+		ExpectedSize:   expectedSize,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Returned when the server responds with a status code we don't accept.
+type StatusError struct {
+	StatusCode int
+	// How long the server asked us to wait, if it sent a Retry-After header.
+	RetryAfter time.Duration
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("status code was not OK: %d", err.StatusCode)
+}
+
+func NewStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+}
+
+// A record of a single request made by the downloader.
+type DownloadAttempt struct {
+	URL string
+	// The 1-based number of this attempt for its URL.
+	Number    int
+	StartTime time.Time
+	EndTime   time.Time
+	// The HTTP status code, or 0 if we never got a response.
+	StatusCode int
+	// How many bytes of the body were read
+	BytesReceived int64
+	// The URL we ended up at after following redirects
+	FinalURL string
+	Err      error
+}
+
+func (attempt *DownloadAttempt) Duration() time.Duration {
+	return attempt.EndTime.Sub(attempt.StartTime)
+}
+
+// The code for why the attempt failed, or ErrorCodeNone if it succeeded.
+func (attempt *DownloadAttempt) ErrorCode() ErrorCode {
+	return ClassifyError(attempt.Err)
+}
+
+func (attempt *DownloadAttempt) Succeeded() bool {
+	return attempt.Err == nil
+}
+
+func (attempt *DownloadAttempt) String() string {
+	if attempt.Err != nil {
+		return fmt.Sprintf("%s (attempt %d): %v", attempt.URL, attempt.Number, attempt.Err)
+	}
+	return fmt.Sprintf("%s (attempt %d): OK", attempt.URL, attempt.Number)
+}
@@ -0,0 +1,126 @@
+package downloader
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"syscall"
+)
+
+// A stable code for why a download failed, so failures can be filtered and grouped.
+type ErrorCode string
+
+const (
+	ErrorCodeNone             ErrorCode = ""
+	ErrorCodeDNS              ErrorCode = "dns"
+	ErrorCodeTLS              ErrorCode = "tls"
+	ErrorCodeTimeout          ErrorCode = "timeout"
+	ErrorCodeConnection       ErrorCode = "connection"
+	ErrorCodeHTTP4xx          ErrorCode = "http_4xx"
+	ErrorCodeHTTP5xx          ErrorCode = "http_5xx"
+	ErrorCodeHTTPOther        ErrorCode = "http_other"
+	ErrorCodeWrongContentType ErrorCode = "wrong_content_type"
+	ErrorCodeEmptyBody        ErrorCode = "empty_body"
+	ErrorCodeInvalidPDF       ErrorCode = "invalid_pdf"
+	ErrorCodeTooLarge         ErrorCode = "too_large"
+	ErrorCodeTooSmall         ErrorCode = "too_small"
+	ErrorCodeSizeMismatch     ErrorCode = "size_mismatch"
+	ErrorCodeChecksumMismatch ErrorCode = "checksum_mismatch"
+	ErrorCodeCancelled        ErrorCode = "cancelled"
+	ErrorCodeDisk             ErrorCode = "disk"
+	ErrorCodeMissingURL       ErrorCode = "missing_url"
+	ErrorCodeDuplicatePath    ErrorCode = "duplicate_path"
+	ErrorCodeUnknown          ErrorCode = "unknown"
+)
+
+// An error tagged with its code, for failures we can't tell apart by type alone.
+type DownloadError struct {
+	Code ErrorCode
+	Err  error
+}
+
+func NewDownloadError(code ErrorCode, err error) *DownloadError {
+	return &DownloadError{code, err}
+}
+
+func (err *DownloadError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *DownloadError) Unwrap() error {
+	return err.Err
+}
+
+// Finds the code for the error.
+// Joined errors are classified by their last error, since that is the final reason we gave up.
+func ClassifyError(err error) ErrorCode {
+	if err == nil {
+		return ErrorCodeNone
+	}
+
+	if code := classifySingleError(err); code != ErrorCodeUnknown {
+		return code
+	}
+
+	switch wrapper := err.(type) {
+	case interface{ Unwrap() []error }:
+		wrapped := wrapper.Unwrap()
+		if len(wrapped) > 0 {
+			return ClassifyError(wrapped[len(wrapped)-1])
+		}
+	case interface{ Unwrap() error }:
+		return ClassifyError(wrapper.Unwrap())
+	}
+
+	return ErrorCodeUnknown
+}
+
+// Classifies the error by itself, without looking at what it wraps.
+func classifySingleError(err error) ErrorCode {
+	switch typedErr := err.(type) {
+	case *DownloadError:
+		return typedErr.Code
+	case *StatusError:
+		switch {
+		case typedErr.StatusCode >= 400 && typedErr.StatusCode < 500:
+			return ErrorCodeHTTP4xx
+		case typedErr.StatusCode >= 500:
+			return ErrorCodeHTTP5xx
+		}
+		return ErrorCodeHTTPOther
+	case *net.DNSError:
+		return ErrorCodeDNS
+	case tls.RecordHeaderError, tls.AlertError, *tls.CertificateVerificationError,
+		x509.UnknownAuthorityError, x509.HostnameError, x509.CertificateInvalidError:
+		return ErrorCodeTLS
+	case *fs.PathError, *os.LinkError:
+		return ErrorCodeDisk
+	case *url.Error:
+		// The server closed the connection before sending a response
+		if typedErr.Err == io.EOF {
+			return ErrorCodeConnection
+		}
+	}
+
+	switch err {
+	case context.Canceled:
+		return ErrorCodeCancelled
+	case context.DeadlineExceeded:
+		return ErrorCodeTimeout
+	case io.ErrUnexpectedEOF, syscall.ECONNRESET, syscall.ECONNREFUSED, syscall.ECONNABORTED, syscall.EPIPE:
+		return ErrorCodeConnection
+	case syscall.ENOSPC, syscall.EDQUOT, syscall.EROFS:
+		return ErrorCodeDisk
+	}
+
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		return ErrorCodeTimeout
+	}
+
+	return ErrorCodeUnknown
+}
@@ -6,27 +6,64 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/utils"
 )
 
 var ErrorEmptyURL = errors.New("empty url")
 
 type ResponseAsserter = func(*http.Response) error
 
+// Consumes the downloaded data. If it returns an error the attempt is considered failed,
+// and may be retried according to the retry policy.
+type DownloadHandler = func(*DownloadData) error
+
+// Lets the caller modify each request before it is sent, for example to add headers.
+// It is called again for each retry, so it can take the outcome of earlier attempts into account.
+type RequestPreparer = func(url string, req *http.Request) error
+
 type Downloader struct {
 	httpClient       *http.Client
 	Ctx              context.Context
 	responseAsserter ResponseAsserter
+	retryPolicy      RetryPolicy
+	hostLimiter      *HostLimiter
+	headers          http.Header
 }
 
 type DownloadData struct {
 	Reader        io.ReadCloser
 	ContentLength int64
+	// The URL that was requested
+	URL        string
+	StatusCode int
+	Header     http.Header
+	// Whether the server supports Range requests for this resource.
+	// This is false if the body was transparently decompressed, since the byte offsets won't match.
+	AcceptsRanges bool
+}
+
+func newDownloadData(url string, resp *http.Response) *DownloadData {
+	return &DownloadData{
+		Reader:        resp.Body,
+		ContentLength: resp.ContentLength,
+		URL:           url,
+		StatusCode:    resp.StatusCode,
+		Header:        resp.Header,
+		AcceptsRanges: resp.Header.Get("Accept-Ranges") == "bytes" && !resp.Uncompressed,
+	}
 }
 
-// The default respose asserter, that just checks for status 200
+// Is this the remainder of a resource requested with a Range header?
+func (data *DownloadData) IsPartial() bool {
+	return data.StatusCode == http.StatusPartialContent
+}
+
+// The default respose asserter, that just checks for status 200 (or 206 for Range requests)
 func DefaultDownloaderResponseAsserter(resp *http.Response) error {
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("status code was not OK: %d", resp.StatusCode)
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return NewStatusError(resp)
 	}
 	return nil
 }
@@ -37,6 +74,9 @@ func NewDownloader(ctx context.Context) *Downloader {
 		httpClient,
 		ctx,
 		DefaultDownloaderResponseAsserter,
+		DefaultRetryPolicy(),
+		NewHostLimiter(DefaultHostLimits(), nil),
+		http.Header{},
 	}
 }
 
@@ -45,34 +85,113 @@ func (dl *Downloader) SetResponseAsserter(asserter ResponseAsserter) {
 	dl.responseAsserter = asserter
 }
 
+// Sets the policy used to retry failed attempts on each URL.
+func (dl *Downloader) SetRetryPolicy(policy RetryPolicy) {
+	dl.retryPolicy = policy
+}
+
+// Sets the per-host connection and delay limits.
+// These apply on top of however many downloads the caller runs at once.
+func (dl *Downloader) SetHostLimiter(limiter *HostLimiter) {
+	dl.hostLimiter = limiter
+}
+
+// Sets extra headers that are sent with every request, like User-Agent or Authorization.
+func (dl *Downloader) SetHeaders(headers http.Header) {
+	dl.headers = headers.Clone()
+}
+
 func (dl *Downloader) Close() {
 	dl.httpClient.CloseIdleConnections()
 }
 
-func (dl *Downloader) downloadUrl(url string) (*DownloadData, error) {
+func (dl *Downloader) downloadUrl(url string, prepare RequestPreparer, handler DownloadHandler, attempt *DownloadAttempt) error {
 	req, err := http.NewRequestWithContext(dl.Ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("could not create HTTP GET request %w", err)
+		return fmt.Errorf("could not create HTTP GET request %w", err)
+	}
+
+	for name, values := range dl.headers {
+		req.Header[name] = values
+	}
+
+	if prepare != nil {
+		if err := prepare(url, req); err != nil {
+			return fmt.Errorf("could not prepare HTTP GET request: %w", err)
+		}
+	}
+
+	// We hold on to the host slot until the handler has read the whole response
+	release, err := dl.hostLimiter.Acquire(dl.Ctx, req.URL.Hostname())
+	if err != nil {
+		return err
 	}
+	defer release()
 
 	resp, err := dl.httpClient.Do(req)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	defer resp.Body.Close()
+
+	attempt.StatusCode = resp.StatusCode
+	attempt.FinalURL = resp.Request.URL.String()
+
+	// Transient errors are caught here so the asserter doesn't have to know about them
+	if dl.retryPolicy.IsRetryableStatus(resp.StatusCode) {
+		return NewStatusError(resp)
 	}
 
 	if err := dl.responseAsserter(resp); err != nil {
-		return nil, err
+		return err
 	}
 
-	return &DownloadData{resp.Body, resp.ContentLength}, nil
+	// Count what the handler reads, so we know how much we got even if it fails halfway
+	counter := &countingReader{ReadCloser: resp.Body}
+	defer func() { attempt.BytesReceived = counter.count }()
+	resp.Body = counter
+
+	return handler(newDownloadData(url, resp))
+}
+
+// Tries a single URL until it either succeeds, fails with a non-retryable error, or runs out of attempts.
+func (dl *Downloader) downloadUrlWithRetries(url string, prepare RequestPreparer, handler DownloadHandler) ([]*DownloadAttempt, error) {
+	attempts := make([]*DownloadAttempt, 0, 1)
+	for number := 1; ; number++ {
+		attempt := &DownloadAttempt{URL: url, Number: number, StartTime: time.Now()}
+		attempts = append(attempts, attempt)
+
+		err := dl.downloadUrl(url, prepare, handler, attempt)
+		attempt.EndTime = time.Now()
+		if err == nil {
+			return attempts, nil
+		}
+
+		// Don't bother with anything else if the user has cancelled
+		if ctxErr := dl.Ctx.Err(); ctxErr != nil {
+			attempt.Err = ctxErr
+			return attempts, ctxErr
+		}
+
+		attempt.Err = err
+		if number >= dl.retryPolicy.maxAttempts() || !dl.retryPolicy.ShouldRetry(err) {
+			return attempts, err
+		}
+
+		if err := utils.SleepContext(dl.Ctx, dl.retryPolicy.Delay(number, err)); err != nil {
+			return attempts, err
+		}
+	}
 }
 
-// Caller must handle closing of reader
-// Both return valus will be nil on empty download strings
-// Returns a data stream and the length of the stream
-func (dl *Downloader) Download(downloadable Downloadable) (*DownloadData, error) {
+// Downloads the first URL of the downloadable that succeeds, and passes the data to the handler.
+// The downloader closes the data reader once the handler returns.
+// prepare is optional, and is called with each request before it is sent.
+// Returns every attempt made, in order, as well as the combined error if none of the URLs succeeded.
+func (dl *Downloader) Download(downloadable Downloadable, prepare RequestPreparer, handler DownloadHandler) ([]*DownloadAttempt, error) {
 	urls := downloadable.GetDownloadableURLs()
 
+	attempts := make([]*DownloadAttempt, 0, len(urls))
 	// We use an empty error like this to join the later ones onto
 	var combinedErr error
 	for _, url := range urls {
@@ -81,13 +200,29 @@ func (dl *Downloader) Download(downloadable Downloadable) (*DownloadData, error)
 			continue
 		}
 
-		data, err := dl.downloadUrl(url)
-		if err != nil {
-			combinedErr = errors.Join(combinedErr, err)
-			continue
+		urlAttempts, err := dl.downloadUrlWithRetries(url, prepare, handler)
+		attempts = append(attempts, urlAttempts...)
+		if err == nil {
+			return attempts, nil
+		}
+
+		if errors.Is(err, context.Canceled) {
+			return attempts, context.Canceled
 		}
-		return data, nil
+
+		combinedErr = errors.Join(combinedErr, err)
 	}
 
-	return nil, combinedErr
+	return attempts, combinedErr
+}
+
+type countingReader struct {
+	io.ReadCloser
+	count int64
+}
+
+func (reader *countingReader) Read(p []byte) (int, error) {
+	n, err := reader.ReadCloser.Read(p)
+	reader.count += int64(n)
+	return n, err
 }
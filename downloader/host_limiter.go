@@ -0,0 +1,160 @@
+package downloader
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+// Politeness limits for requests to a single host.
+type HostLimits struct {
+	// Maximum amount of requests in flight to the host at once. 0 means unlimited.
+	MaxConnections int
+	// Minimum time between the start of two requests to the host.
+	MinDelay time.Duration
+}
+
+func DefaultHostLimits() HostLimits {
+	return HostLimits{
+		MaxConnections: 4,
+		MinDelay:       0,
+	}
+}
+
+type hostState struct {
+	// A counting semaphore, nil if there is no connection limit
+	slots chan struct{}
+
+	mu          sync.Mutex
+	nextRequest time.Time
+	minDelay    time.Duration
+}
+
+// Keeps track of the requests made to each host, and makes sure they stay within their limits.
+type HostLimiter struct {
+	defaults  HostLimits
+	overrides map[string]HostLimits
+
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// Overrides are keyed by domain, and also apply to all subdomains of that domain.
+func NewHostLimiter(defaults HostLimits, overrides map[string]HostLimits) *HostLimiter {
+	normalizedOverrides := make(map[string]HostLimits, len(overrides))
+	for domain, limits := range overrides {
+		normalizedOverrides[strings.ToLower(domain)] = limits
+	}
+
+	return &HostLimiter{
+		defaults:  defaults,
+		overrides: normalizedOverrides,
+		hosts:     make(map[string]*hostState),
+	}
+}
+
+// Finds the most specific override for the host, or the defaults if there is none.
+func (limiter *HostLimiter) limitsFor(host string) HostLimits {
+	domain := host
+	for {
+		if limits, ok := limiter.overrides[domain]; ok {
+			return limits
+		}
+
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			return limiter.defaults
+		}
+		domain = parent
+	}
+}
+
+func (limiter *HostLimiter) stateFor(host string) *hostState {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	state, ok := limiter.hosts[host]
+	if ok {
+		return state
+	}
+
+	limits := limiter.limitsFor(host)
+	state = &hostState{minDelay: limits.MinDelay}
+	if limits.MaxConnections > 0 {
+		state.slots = make(chan struct{}, limits.MaxConnections)
+	}
+	limiter.hosts[host] = state
+	return state
+}
+
+// Blocks until a request to the host is allowed, or the context is cancelled.
+// The returned release func must be called once the request is completely done.
+func (limiter *HostLimiter) Acquire(ctx context.Context, host string) (release func(), err error) {
+	state := limiter.stateFor(strings.ToLower(host))
+
+	if state.slots != nil {
+		select {
+		case state.slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release = func() {
+		if state.slots != nil {
+			<-state.slots
+		}
+	}
+
+	// Reserve the next available time slot, so concurrent callers are spaced out by the delay
+	state.mu.Lock()
+	now := time.Now()
+	startAt := state.nextRequest
+	if startAt.Before(now) {
+		startAt = now
+	}
+	state.nextRequest = startAt.Add(state.minDelay)
+	state.mu.Unlock()
+
+	if err := utils.SleepContext(ctx, startAt.Sub(now)); err != nil {
+		release()
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// Parses per-domain overrides in the form "domain:connections:delay,domain:connections:delay"
+// e.g. "example.com:2:500ms,cdn.example.org:1:2s"
+func ParseHostLimitOverrides(spec string) (map[string]HostLimits, error) {
+	overrides := make(map[string]HostLimits)
+	if strings.TrimSpace(spec) == "" {
+		return overrides, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		parts := strings.Split(strings.TrimSpace(entry), ":")
+		if len(parts) != 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid host limit '%s', must be in the form domain:connections:delay", entry)
+		}
+
+		connections, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid connection limit in host limit '%s': %w", entry, err)
+		}
+
+		delay, err := time.ParseDuration(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid delay in host limit '%s': %w", entry, err)
+		}
+
+		overrides[parts[0]] = HostLimits{MaxConnections: connections, MinDelay: delay}
+	}
+
+	return overrides, nil
+}
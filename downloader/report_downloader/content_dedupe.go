@@ -0,0 +1,162 @@
+package report_downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Decides what to do when a report has the same content as one downloaded before it.
+type DedupeMode int
+
+const (
+	// Keep a separate copy of every report
+	DedupeOff DedupeMode = iota
+	// Replace the copy with a hard link to the first file with the content
+	DedupeHardlink
+	// Replace the copy with a symbolic link to the first file with the content
+	DedupeSymlink
+	// Delete the copy, and point the metadata to the first file with the content
+	DedupeReference
+)
+
+func ParseDedupeMode(mode string) (DedupeMode, error) {
+	switch mode {
+	case "", "off":
+		return DedupeOff, nil
+	case "hardlink":
+		return DedupeHardlink, nil
+	case "symlink":
+		return DedupeSymlink, nil
+	case "reference":
+		return DedupeReference, nil
+	}
+	return DedupeOff, fmt.Errorf("unknown dedupe mode '%s', must be one of off, hardlink, symlink or reference", mode)
+}
+
+func (mode DedupeMode) String() string {
+	switch mode {
+	case DedupeOff:
+		return "off"
+	case DedupeHardlink:
+		return "hardlink"
+	case DedupeSymlink:
+		return "symlink"
+	case DedupeReference:
+		return "reference"
+	}
+	return "unknown"
+}
+
+// Keeps track of the first result with each content hash, so later ones can be deduplicated against it.
+type contentIndex struct {
+	mutex     sync.Mutex
+	canonical map[string]*ReportDownloadResult
+}
+
+func newContentIndex() *contentIndex {
+	return &contentIndex{canonical: make(map[string]*ReportDownloadResult)}
+}
+
+// Returns the first result with the same content, or registers this one as the first if there is none.
+func (index *contentIndex) claim(result *ReportDownloadResult) (*ReportDownloadResult, bool) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+
+	if canonical, ok := index.canonical[result.SHA256]; ok {
+		return canonical, true
+	}
+	index.canonical[result.SHA256] = result
+	return nil, false
+}
+
+// Replaces the file at path with a link to target.
+// The link is made next to it first, so the file is never missing if something goes wrong.
+func replaceWithLink(path string, target string, mode DedupeMode) error {
+	linkPath := path + ".link"
+	os.Remove(linkPath)
+
+	var err error
+	if mode == DedupeSymlink {
+		// Relative, so the output directory can still be moved
+		relativeTarget, relErr := filepath.Rel(filepath.Dir(path), target)
+		if relErr != nil {
+			return relErr
+		}
+		err = os.Symlink(relativeTarget, linkPath)
+	} else {
+		err = os.Link(target, linkPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(linkPath, path); err != nil {
+		os.Remove(linkPath)
+		return err
+	}
+	return nil
+}
+
+// Checks whether the result has the same content as an earlier one, and if so replaces its file according to the dedupe mode.
+// Only reports downloaded in this run are replaced, files from earlier runs are only used as the originals.
+func (dl *ReportDownloader) dedupeResult(result *ReportDownloadResult) error {
+	// Duplicates kept from an earlier run are never the originals
+	if dl.dedupeMode == DedupeOff || result.SHA256 == "" || result.ContentDuplicateOf != "" {
+		return nil
+	}
+
+	canonical, isDuplicate := dl.contents.claim(result)
+	if !isDuplicate || !result.State.IsDone() {
+		return nil
+	}
+
+	path := result.State.WrittenPath
+	target := canonical.State.WrittenPath
+	if sameFile(path, target) {
+		return nil
+	}
+
+	if dl.dedupeMode == DedupeReference {
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("could not remove duplicate file: %w", err)
+		}
+		result.State.WrittenPath = target
+	} else if err := replaceWithLink(path, target, dl.dedupeMode); err != nil {
+		// Keeping the copy is better than losing the report, so it just isn't deduplicated
+		return fmt.Errorf("could not link '%s' to '%s': %w", path, target, err)
+	}
+
+	result.ContentDuplicateOf = canonical.AssociatedReport.Id
+	result.BytesSaved = result.Size
+	return nil
+}
+
+// Remembers the content of the result for the next incremental run,
+// so links and references can be checked against it, and references can be found at all.
+func (dl *ReportDownloader) recordContent(result *ReportDownloadResult, fullDownloadPath string) {
+	if result.State.WrittenPath == "" || result.SHA256 == "" {
+		return
+	}
+
+	contentPath := ""
+	if result.State.WrittenPath != fullDownloadPath {
+		if relativePath, err := filepath.Rel(dl.outputDir, result.State.WrittenPath); err == nil {
+			contentPath = filepath.ToSlash(relativePath)
+		}
+	}
+	dl.validators.setContent(result.AssociatedReport.Id, result.SHA256, result.ContentDuplicateOf, contentPath)
+}
+
+func sameFile(a string, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
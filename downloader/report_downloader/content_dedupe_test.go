@@ -0,0 +1,138 @@
+package report_downloader
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+// Serves a PDF for each path, and counts the requests for each of them.
+type documentServer struct {
+	*httptest.Server
+	mutex     sync.Mutex
+	documents map[string][]byte
+	requests  map[string]int
+}
+
+func newDocumentServer(t *testing.T, documents map[string][]byte) *documentServer {
+	server := &documentServer{documents: documents, requests: make(map[string]int)}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		server.requests[r.URL.Path]++
+		document, ok := server.documents[r.URL.Path]
+		server.mutex.Unlock()
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write(document)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (server *documentServer) requestCount() int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	count := 0
+	for _, requests := range server.requests {
+		count += requests
+	}
+	return count
+}
+
+func (server *documentServer) requestsFor(path string) int {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	return server.requests[path]
+}
+
+func (server *documentServer) reports() []*models.Report {
+	return []*models.Report{
+		{Id: "a", DownloadLinks: []string{server.URL + "/a.pdf"}},
+		{Id: "b", DownloadLinks: []string{server.URL + "/b.pdf"}},
+	}
+}
+
+// Runs in order, so report a is always the original of report b.
+func downloadIncrementally(directory string, reports []*models.Report, dedupeMode DedupeMode) []*ReportDownloadResult {
+	dl := NewReportDownloader(context.Background(), directory)
+	defer dl.Close()
+	dl.SetRetryPolicy(downloader.RetryPolicy{MaxAttempts: 1})
+	dl.SetConcurrency(1)
+	dl.SetIncrementalMode(IncrementalSkip)
+	dl.SetDedupeMode(dedupeMode)
+	return dl.DownloadReports(reports)
+}
+
+func TestReferenceDuplicatesAreSkippedOnTheNextRun(t *testing.T) {
+	pdf := minimalPdf()
+	server := newDocumentServer(t, map[string][]byte{"/a.pdf": pdf, "/b.pdf": pdf})
+	directory := t.TempDir()
+
+	first := downloadIncrementally(directory, server.reports(), DedupeReference)
+	if first[1].ContentDuplicateOf != "a" {
+		t.Fatalf("expected b to be a duplicate of a, got '%s'", first[1].ContentDuplicateOf)
+	}
+	if _, err := os.Stat(filepath.Join(directory, "b.pdf")); !os.IsNotExist(err) {
+		t.Fatalf("expected the file of the duplicate to be removed")
+	}
+
+	requestsBefore := server.requestCount()
+	second := downloadIncrementally(directory, server.reports(), DedupeReference)
+	if requests := server.requestCount() - requestsBefore; requests != 0 {
+		t.Errorf("expected no requests on the second run, got %d", requests)
+	}
+
+	for _, result := range second {
+		if !result.State.IsSkipped() {
+			t.Errorf("expected %s to be skipped, got state %s", result.AssociatedReport.Id, result.State)
+		}
+	}
+	if second[1].State.WrittenPath != first[0].State.WrittenPath {
+		t.Errorf("expected the duplicate to point to '%s', got '%s'", first[0].State.WrittenPath, second[1].State.WrittenPath)
+	}
+	if second[1].ContentDuplicateOf != "a" {
+		t.Errorf("expected b to still be a duplicate of a, got '%s'", second[1].ContentDuplicateOf)
+	}
+}
+
+func TestSymlinkDuplicateOfChangedFileIsDownloadedAgain(t *testing.T) {
+	pdf := minimalPdf()
+	server := newDocumentServer(t, map[string][]byte{"/a.pdf": pdf, "/b.pdf": pdf})
+	directory := t.TempDir()
+
+	first := downloadIncrementally(directory, server.reports(), DedupeSymlink)
+	if first[1].ContentDuplicateOf != "a" {
+		t.Skipf("could not make symbolic links here: %v", first[1].State)
+	}
+
+	// The original is replaced by a newer version, which the link would otherwise silently follow
+	newer := minimalPdfWithPageSize(300)
+	if err := os.WriteFile(filepath.Join(directory, "a.pdf"), newer, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	downloadIncrementally(directory, server.reports(), DedupeSymlink)
+	if requests := server.requestsFor("/b.pdf"); requests != 2 {
+		t.Errorf("expected the duplicate to be downloaded again, got %d requests", requests)
+	}
+
+	written, err := os.ReadFile(filepath.Join(directory, "b.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, pdf) {
+		t.Errorf("expected the duplicate to keep its own content")
+	}
+}
@@ -0,0 +1,175 @@
+package report_downloader
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+var ErrorDuplicateIds = errors.New("duplicate report IDs")
+
+// How many duplicate IDs are listed in the error, so a bad input doesn't flood the terminal
+const maxListedDuplicates = 10
+
+// Decides what to do when several reports have the same ID.
+type DuplicatePolicy int
+
+const (
+	// Give each duplicate a unique ID by adding _2, _3 and so on, so every report is downloaded
+	DuplicateSuffix DuplicatePolicy = iota
+	// Stop before downloading anything
+	DuplicateFail
+	// Only download the first report with the ID
+	DuplicateKeepFirst
+	// Only download the last report with the ID
+	DuplicateKeepLast
+)
+
+func ParseDuplicatePolicy(policy string) (DuplicatePolicy, error) {
+	switch policy {
+	case "", "suffix":
+		return DuplicateSuffix, nil
+	case "fail":
+		return DuplicateFail, nil
+	case "keep-first":
+		return DuplicateKeepFirst, nil
+	case "keep-last":
+		return DuplicateKeepLast, nil
+	}
+	return DuplicateSuffix, fmt.Errorf("unknown duplicate ID policy '%s', must be one of fail, keep-first, keep-last or suffix", policy)
+}
+
+func (policy DuplicatePolicy) String() string {
+	switch policy {
+	case DuplicateSuffix:
+		return "suffix"
+	case DuplicateFail:
+		return "fail"
+	case DuplicateKeepFirst:
+		return "keep-first"
+	case DuplicateKeepLast:
+		return "keep-last"
+	}
+	return "unknown"
+}
+
+// Describes where a report came from, by its row if we know it, otherwise by its position in the input.
+func describeReportPosition(reports []*models.Report, index int) string {
+	if row := reports[index].SourceRow; row > 0 {
+		return "row " + strconv.Itoa(row)
+	}
+	return "entry " + strconv.Itoa(index+1)
+}
+
+func describePositions(reports []*models.Report, indices []int) string {
+	positions := make([]string, 0, len(indices))
+	for _, index := range indices {
+		positions = append(positions, describeReportPosition(reports, index))
+	}
+	return strings.Join(positions, ", ")
+}
+
+// Groups the indices of the reports by ID, keeping only the IDs that are used more than once.
+// The IDs are returned in the order they first appear.
+// Reports without an ID, like blank rows, aren't duplicates of each other, so they are left out.
+func findDuplicateIds(reports []*models.Report) ([]string, map[string][]int) {
+	indicesById := make(map[string][]int)
+	ids := make([]string, 0)
+	for i, report := range reports {
+		if report.Id == "" {
+			continue
+		}
+		if _, seen := indicesById[report.Id]; !seen {
+			ids = append(ids, report.Id)
+		}
+		indicesById[report.Id] = append(indicesById[report.Id], i)
+	}
+
+	duplicateIds := make([]string, 0)
+	for _, id := range ids {
+		if len(indicesById[id]) > 1 {
+			duplicateIds = append(duplicateIds, id)
+		} else {
+			delete(indicesById, id)
+		}
+	}
+	return duplicateIds, indicesById
+}
+
+// Finds a suffixed ID that no other report has
+func uniqueSuffixedId(id string, number int, usedIds map[string]bool) string {
+	for {
+		suffixed := id + "_" + strconv.Itoa(number)
+		if !usedIds[suffixed] {
+			return suffixed
+		}
+		number++
+	}
+}
+
+// Applies the policy to reports that share an ID, before they are downloaded.
+// The decision is recorded in the DuplicateDecision of every report involved, and reports that
+// shouldn't be downloaded are marked as DroppedAsDuplicate.
+// Returns an error wrapping ErrorDuplicateIds if the policy is to fail and there are duplicates.
+func ResolveDuplicateIds(reports []*models.Report, policy DuplicatePolicy) error {
+	duplicateIds, indicesById := findDuplicateIds(reports)
+	if len(duplicateIds) == 0 {
+		return nil
+	}
+
+	if policy == DuplicateFail {
+		listed := make([]string, 0, maxListedDuplicates)
+		for _, id := range duplicateIds[:min(len(duplicateIds), maxListedDuplicates)] {
+			listed = append(listed, fmt.Sprintf("'%s' (%s)", id, describePositions(reports, indicesById[id])))
+		}
+		if len(duplicateIds) > maxListedDuplicates {
+			listed = append(listed, fmt.Sprintf("and %d more", len(duplicateIds)-maxListedDuplicates))
+		}
+		return fmt.Errorf("%w: %d IDs are used by more than one report: %s", ErrorDuplicateIds, len(duplicateIds), strings.Join(listed, ", "))
+	}
+
+	usedIds := make(map[string]bool, len(reports))
+	for _, report := range reports {
+		usedIds[report.Id] = true
+	}
+
+	for _, id := range duplicateIds {
+		indices := indicesById[id]
+
+		keptIndex := indices[0]
+		if policy == DuplicateKeepLast {
+			keptIndex = indices[len(indices)-1]
+		}
+
+		others := make([]int, 0, len(indices)-1)
+		for _, index := range indices {
+			if index != keptIndex {
+				others = append(others, index)
+			}
+		}
+
+		kept := reports[keptIndex]
+		switch policy {
+		case DuplicateSuffix:
+			kept.DuplicateDecision = fmt.Sprintf("kept ID, the duplicates in %s were renamed", describePositions(reports, others))
+			for number, index := range others {
+				report := reports[index]
+				report.Id = uniqueSuffixedId(id, number+2, usedIds)
+				usedIds[report.Id] = true
+				report.DuplicateDecision = fmt.Sprintf("renamed from '%s' to '%s', since %s has the same ID", id, report.Id, describeReportPosition(reports, keptIndex))
+			}
+		case DuplicateKeepFirst, DuplicateKeepLast:
+			kept.DuplicateDecision = fmt.Sprintf("kept, the duplicates in %s were dropped", describePositions(reports, others))
+			for _, index := range others {
+				reports[index].DroppedAsDuplicate = true
+				reports[index].DuplicateDecision = fmt.Sprintf("dropped, %s with the same ID was kept", describeReportPosition(reports, keptIndex))
+			}
+		}
+	}
+
+	fmt.Printf("Found %d IDs used by more than one report, resolved with the '%s' policy.\n", len(duplicateIds), policy)
+	return nil
+}
@@ -0,0 +1,53 @@
+package report_downloader
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/models"
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+func hasExpectedContent(report *models.Report) bool {
+	return report.ExpectedSHA256 != "" || report.ExpectedSize > 0
+}
+
+// Checks the size the server says the document has against the expected one, so we can give up on a URL before downloading it.
+// A negative size means the server didn't tell us.
+func checkExpectedSize(report *models.Report, size int64) error {
+	if report.ExpectedSize <= 0 || size < 0 || size == report.ExpectedSize {
+		return nil
+	}
+	return downloader.NewDownloadError(downloader.ErrorCodeSizeMismatch, fmt.Errorf("size is %d bytes, expected %d", size, report.ExpectedSize))
+}
+
+// Checks a downloaded file against the expected hash and size of the report.
+func checkExpectedContent(report *models.Report, file downloadedFile) error {
+	if err := checkExpectedSize(report, file.size); err != nil {
+		return err
+	}
+	if report.ExpectedSHA256 != "" && file.sha256 != report.ExpectedSHA256 {
+		return downloader.NewDownloadError(downloader.ErrorCodeChecksumMismatch, fmt.Errorf("SHA-256 is %s, expected %s", file.sha256, report.ExpectedSHA256))
+	}
+	return nil
+}
+
+// Checks if a file we already have matches the expected hash and size of the report.
+// Only reads the whole file if there is a hash to compare against.
+func fileMatchesExpected(report *models.Report, path string) bool {
+	if !hasExpectedContent(report) {
+		return true
+	}
+
+	if report.ExpectedSHA256 == "" {
+		info, err := os.Stat(path)
+		return err == nil && info.Size() == report.ExpectedSize
+	}
+
+	hash, size, err := utils.HashFile(path)
+	if err != nil {
+		return false
+	}
+	return checkExpectedContent(report, downloadedFile{hash, size}) == nil
+}
@@ -0,0 +1,131 @@
+package report_downloader
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+// The file name used unless otherwise specified, which is how the files have always been named.
+const DefaultFilenameTemplate = "{id}.pdf"
+
+// The longest a single file or directory name can be, in bytes.
+// Most file systems allow 255, but we need room for the .part.json suffix of partial downloads.
+const maxFilenameLength = 200
+
+var placeholderPattern = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Characters that aren't allowed in file names on Windows (and so on most network shares), along with control characters.
+var invalidFilenameChars = regexp.MustCompile(`[<>:"/\\|?*\x00-\x1f\x7f]`)
+
+// Names Windows reserves for devices, which can't be used even with an extension
+var reservedFilenamePattern = regexp.MustCompile(`(?i)^(con|prn|aux|nul|com[0-9]|lpt[0-9])(\..*)?$`)
+
+// Reads each template placeholder from a report
+var placeholderFields = map[string]func(*models.Report) string{
+	"id":   func(report *models.Report) string { return report.Id },
+	"name": func(report *models.Report) string { return report.Name },
+	"year": func(report *models.Report) string { return report.Year },
+}
+
+// Decides where in the output directory each report is saved, from a template like "{year}/{id}.pdf".
+// A / in the template makes a sub directory.
+type FilenameTemplate struct {
+	template string
+}
+
+func ParseFilenameTemplate(template string) (*FilenameTemplate, error) {
+	template = strings.ReplaceAll(strings.TrimSpace(template), "\\", "/")
+	if template == "" {
+		return nil, fmt.Errorf("filename template can not be empty")
+	}
+	if strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("filename template '%s' must be relative to the output directory", template)
+	}
+
+	for _, segment := range strings.Split(template, "/") {
+		if segment == ".." {
+			return nil, fmt.Errorf("filename template '%s' can not point outside the output directory", template)
+		}
+	}
+
+	for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		if _, ok := placeholderFields[match[1]]; !ok {
+			return nil, fmt.Errorf("unknown placeholder '%s' in filename template, must be one of {id}, {name} or {year}", match[0])
+		}
+	}
+
+	// Every report is a PDF, so there is no reason to make people type it
+	if !strings.HasSuffix(strings.ToLower(template), ".pdf") {
+		template += ".pdf"
+	}
+
+	return &FilenameTemplate{template}, nil
+}
+
+func (template *FilenameTemplate) String() string {
+	return template.template
+}
+
+// Returns the path of the report relative to the output directory, with / as separator.
+// The fields of the report can't add directories, and the result never points outside the output directory.
+func (template *FilenameTemplate) RelativePath(report *models.Report) string {
+	filled := placeholderPattern.ReplaceAllStringFunc(template.template, func(placeholder string) string {
+		field := placeholderFields[strings.Trim(placeholder, "{}")]
+		// Replace separators here, so they only come from the template itself
+		return invalidFilenameChars.ReplaceAllString(field(report), "_")
+	})
+
+	segments := strings.Split(filled, "/")
+	cleanSegments := make([]string, 0, len(segments))
+	for i, segment := range segments {
+		isLast := i == len(segments)-1
+		if segment == "" && !isLast {
+			// Skip empty directories, from an empty field or things like "//" in the template
+			continue
+		}
+		cleanSegments = append(cleanSegments, sanitizeFilename(segment, isLast))
+	}
+	return path.Join(cleanSegments...)
+}
+
+// Makes a single file or directory name safe to use on Windows and Unix alike.
+// If keepExtension is set, the rules apply to the name without its extension, so an empty field can't leave just ".pdf".
+func sanitizeFilename(name string, keepExtension bool) string {
+	name = invalidFilenameChars.ReplaceAllString(name, "_")
+
+	extension := ""
+	if keepExtension {
+		extension = path.Ext(name)
+		name = strings.TrimSuffix(name, extension)
+	}
+
+	// Windows silently drops trailing dots and spaces, so two different names could end up as the same file
+	name = strings.TrimRight(strings.TrimSpace(name), ". ")
+
+	if name == "" {
+		name = "_"
+	}
+	if reservedFilenamePattern.MatchString(name) {
+		name = "_" + name
+	}
+
+	return truncateFilename(name, len(extension)) + extension
+}
+
+// Cuts the name down so it is at most maxFilenameLength bytes along with the extension, without splitting a character.
+func truncateFilename(name string, extensionLength int) string {
+	limit := maxFilenameLength - extensionLength
+	if len(name) <= limit {
+		return name
+	}
+
+	for limit > 0 && !utf8.RuneStart(name[limit]) {
+		limit--
+	}
+	return strings.TrimRight(name[:limit], ". ")
+}
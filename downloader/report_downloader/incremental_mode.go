@@ -0,0 +1,115 @@
+package report_downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader/report_download_state"
+	"github.com/F0903/pdf_downloader_uge5/models"
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+// Decides what to do with reports that have already been downloaded to the output directory.
+type IncrementalMode int
+
+const (
+	// Download everything again
+	IncrementalOff IncrementalMode = iota
+	// Skip reports whose file is already present and valid
+	IncrementalSkip
+	// Ask the server whether present reports have changed, and only download them again if they have
+	IncrementalRevalidate
+)
+
+func ParseIncrementalMode(mode string) (IncrementalMode, error) {
+	switch mode {
+	case "", "off":
+		return IncrementalOff, nil
+	case "skip":
+		return IncrementalSkip, nil
+	case "revalidate":
+		return IncrementalRevalidate, nil
+	}
+	return IncrementalOff, fmt.Errorf("unknown incremental mode '%s', must be one of off, skip or revalidate", mode)
+}
+
+func (mode IncrementalMode) String() string {
+	switch mode {
+	case IncrementalOff:
+		return "off"
+	case IncrementalSkip:
+		return "skip"
+	case IncrementalRevalidate:
+		return "revalidate"
+	}
+	return "unknown"
+}
+
+// Makes the request conditional on the document having changed since we downloaded it from the same URL.
+func addConditionalHeaders(url string, req *http.Request, validators resourceValidators) {
+	// If we are resuming a partial download it is the partial we care about, not the old document
+	if validators.URL != url || req.Header.Get("Range") != "" {
+		return
+	}
+
+	if validators.ETag != "" {
+		req.Header.Set("If-None-Match", validators.ETag)
+	}
+	if validators.LastModified != "" {
+		req.Header.Set("If-Modified-Since", validators.LastModified)
+	}
+}
+
+// A good copy of a report from an earlier run.
+type presentCopy struct {
+	path   string
+	file   downloadedFile
+	stored storedReport
+}
+
+// Finds a good copy of the report from an earlier run. That is its own file,
+// or the file with its content if it was deduplicated by reference and has no file of its own.
+func (dl *ReportDownloader) findPresentCopy(report *models.Report, fullDownloadPath string) (*presentCopy, bool) {
+	if dl.incrementalMode == IncrementalOff {
+		return nil, false
+	}
+
+	stored, _ := dl.validators.get(report.Id)
+	path := fullDownloadPath
+	if _, err := os.Lstat(fullDownloadPath); errors.Is(err, fs.ErrNotExist) && stored.ContentPath != "" {
+		path = filepath.Join(dl.outputDir, filepath.FromSlash(stored.ContentPath))
+	}
+
+	if ValidatePdf(path) != nil || !fileMatchesExpected(report, path) {
+		return nil, false
+	}
+
+	present := &presentCopy{path: path, stored: stored}
+	// Symbolic links and references follow the file of another report, which may have been replaced since.
+	// Hard links keep the old content, so they can't drift like that.
+	if stored.ContentDuplicateOf != "" && stored.SHA256 != "" {
+		hash, size, err := utils.HashFile(path)
+		if err != nil || hash != stored.SHA256 {
+			return nil, false
+		}
+		present.file = downloadedFile{hash, size}
+	}
+	return present, true
+}
+
+// Makes the result for a report we didn't have to download again.
+func (present *presentCopy) result(report *models.Report, state *report_download_state.ReportDownloadState, attempts []*downloader.DownloadAttempt) *ReportDownloadResult {
+	result := NewReportDownloadResult(report, state, attempts)
+	result.SHA256 = present.file.sha256
+	result.Size = present.file.size
+	if present.stored.ContentDuplicateOf != "" {
+		result.ContentDuplicateOf = present.stored.ContentDuplicateOf
+		result.BytesSaved = present.file.size
+	}
+	return result
+}
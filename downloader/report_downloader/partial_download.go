@@ -0,0 +1,203 @@
+package report_downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+)
+
+// Downloads are written to a .part file next to the final path, and only moved into place once complete.
+// Alongside it we keep a small JSON file with what we need to resume the download later.
+type partialDownload struct {
+	resourceValidators
+	AcceptRanges bool `json:"accept_ranges"`
+	// The size of the whole document, or -1 if the server didn't tell us
+	Size int64 `json:"size"`
+}
+
+func partFilePath(fullPath string) string {
+	return fullPath + ".part"
+}
+
+func partInfoPath(fullPath string) string {
+	return fullPath + ".part.json"
+}
+
+func newPartialDownload(data *downloader.DownloadData) *partialDownload {
+	return &partialDownload{
+		resourceValidators: newResourceValidators(data),
+		AcceptRanges:       data.AcceptsRanges,
+		Size:               documentSize(data.IsPartial(), data.ContentLength, data.Header.Get("Content-Range")),
+	}
+}
+
+// The full size of the document in a response, or -1 if the server didn't tell us.
+// For partial responses Content-Length is only the remainder, so we add where it starts.
+func documentSize(isPartial bool, contentLength int64, contentRange string) int64 {
+	if contentLength < 0 || !isPartial {
+		return contentLength
+	}
+
+	start, err := parseContentRangeStart(contentRange)
+	if err != nil {
+		return -1
+	}
+	return start + contentLength
+}
+
+// The validator to send with If-Range, or "" if we have nothing the server can compare against.
+func (partial *partialDownload) ifRangeValidator() string {
+	// Weak ETags are not allowed in If-Range
+	if partial.ETag != "" && !strings.HasPrefix(partial.ETag, "W/") {
+		return partial.ETag
+	}
+	return partial.LastModified
+}
+
+// Loads the info about a previous partial download, and how many bytes of it we have.
+// Returns nil if there is nothing to resume.
+func loadPartialDownload(fullPath string) (*partialDownload, int64) {
+	stat, err := os.Stat(partFilePath(fullPath))
+	if err != nil || stat.Size() == 0 {
+		return nil, 0
+	}
+
+	infoBytes, err := os.ReadFile(partInfoPath(fullPath))
+	if err != nil {
+		return nil, 0
+	}
+
+	// Resume info from before we kept the size doesn't know it
+	partial := &partialDownload{Size: -1}
+	if err := json.Unmarshal(infoBytes, partial); err != nil {
+		return nil, 0
+	}
+
+	return partial, stat.Size()
+}
+
+func (partial *partialDownload) save(fullPath string) error {
+	infoBytes, err := json.Marshal(partial)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(partInfoPath(fullPath), infoBytes, 0644)
+}
+
+func removePartialDownload(fullPath string) {
+	os.Remove(partFilePath(fullPath))
+	os.Remove(partInfoPath(fullPath))
+}
+
+// Can the partial download be picked up again later?
+func isResumable(fullPath string) bool {
+	partial, _ := loadPartialDownload(fullPath)
+	return partial != nil && partial.AcceptRanges && partial.ifRangeValidator() != ""
+}
+
+// Gets rid of a .part file we can't use.
+// If quarantineDir is set the file is moved there for inspection instead of being deleted.
+func discardPartialDownload(fullPath string, quarantineDir string) error {
+	defer removePartialDownload(fullPath)
+
+	if quarantineDir == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(partFilePath(fullPath)); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err := os.MkdirAll(quarantineDir, os.ModePerm); err != nil {
+		return fmt.Errorf("could not create quarantine directory: %w", err)
+	}
+
+	quarantinePath := uniqueQuarantinePath(quarantineDir, filepath.Base(fullPath))
+	if err := os.Rename(partFilePath(fullPath), quarantinePath); err != nil {
+		return fmt.Errorf("could not move file to quarantine: %w", err)
+	}
+
+	return nil
+}
+
+// Files are named by when they were rejected, so several rejected downloads of the same report,
+// or of reports with the same file name in different directories, don't overwrite each other.
+func uniqueQuarantinePath(quarantineDir string, fileName string) string {
+	extension := filepath.Ext(fileName)
+	name := strings.TrimSuffix(fileName, extension) + "_" + time.Now().Format("20060102-150405.000")
+
+	quarantinePath := filepath.Join(quarantineDir, name+extension)
+	for number := 2; ; number++ {
+		if _, err := os.Stat(quarantinePath); errors.Is(err, fs.ErrNotExist) {
+			return quarantinePath
+		}
+		quarantinePath = filepath.Join(quarantineDir, name+"_"+strconv.Itoa(number)+extension)
+	}
+}
+
+// Moves the completed .part file to its final path, and cleans up the resume info.
+func finishPartialDownload(fullPath string) error {
+	if err := os.Rename(partFilePath(fullPath), fullPath); err != nil {
+		return fmt.Errorf("could not move downloaded file into place: %w", err)
+	}
+
+	if err := os.Remove(partInfoPath(fullPath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove resume info: %w", err)
+	}
+
+	return nil
+}
+
+// Adds the Range headers to the request if we have a partial download from the same URL that the server lets us resume.
+func addResumeHeaders(fullPath string, url string, req *http.Request) {
+	partial, offset := loadPartialDownload(fullPath)
+	if partial == nil || partial.URL != url || !partial.AcceptRanges {
+		return
+	}
+
+	// The server would answer a range starting at or past the end with 416, so we just start over
+	if partial.Size >= 0 && offset >= partial.Size {
+		removePartialDownload(fullPath)
+		return
+	}
+
+	validator := partial.ifRangeValidator()
+	if validator == "" {
+		// Without a validator we can't be sure the resource hasn't changed since, so just start over.
+		return
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	req.Header.Set("If-Range", validator)
+}
+
+// Did the server refuse the Range we asked for? This happens if the .part file already has every byte,
+// and the resume info doesn't know the size of the document.
+func isRangeNotSatisfiable(err error) bool {
+	var statusErr *downloader.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusRequestedRangeNotSatisfiable
+}
+
+// Parses the start offset from a Content-Range header in the form "bytes start-end/size"
+func parseContentRangeStart(contentRange string) (int64, error) {
+	rangeSpec, ok := strings.CutPrefix(contentRange, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("unsupported Content-Range '%s'", contentRange)
+	}
+
+	start, _, ok := strings.Cut(rangeSpec, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid Content-Range '%s'", contentRange)
+	}
+
+	return strconv.ParseInt(start, 10, 64)
+}
@@ -0,0 +1,170 @@
+package report_downloader
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+// Builds the smallest PDF we consider valid, with a correct cross reference table.
+func minimalPdf() []byte {
+	return minimalPdfWithPageSize(200)
+}
+
+// Same as minimalPdf, but the page size can be changed to get different content.
+func minimalPdfWithPageSize(size int) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << >> >>", size, size),
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xrefOffset := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+	return pdf.Bytes()
+}
+
+// Serves the PDF with range support, like most servers do, and records the Range header of each request.
+type rangeServer struct {
+	*httptest.Server
+	mutex  sync.Mutex
+	ranges []string
+}
+
+func newRangeServer(t *testing.T, pdf []byte) *rangeServer {
+	server := &rangeServer{}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		server.ranges = append(server.ranges, r.Header.Get("Range"))
+		server.mutex.Unlock()
+
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "report.pdf", time.Unix(1700000000, 0), bytes.NewReader(pdf))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// Leaves a .part file with every byte of the document, as if we were killed right before moving it into place.
+func writeCompletePartFile(t *testing.T, fullPath string, pdf []byte, resumeInfo string) {
+	if err := os.WriteFile(partFilePath(fullPath), pdf, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(partInfoPath(fullPath), []byte(resumeInfo), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func downloadSingleReport(t *testing.T, directory string, url string) *ReportDownloadResult {
+	dl := NewReportDownloader(context.Background(), directory)
+	defer dl.Close()
+	dl.SetRetryPolicy(downloader.RetryPolicy{MaxAttempts: 1})
+
+	results := dl.DownloadReports([]*models.Report{{Id: "r1", DownloadLinks: []string{url}}})
+	return results[0]
+}
+
+func checkDownloaded(t *testing.T, result *ReportDownloadResult, fullPath string, pdf []byte) {
+	if !result.State.IsDone() {
+		t.Fatalf("expected the report to be downloaded, got state %s", result.State)
+	}
+
+	written, err := os.ReadFile(fullPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, pdf) {
+		t.Errorf("the downloaded file is not the document")
+	}
+
+	for _, path := range []string{partFilePath(fullPath), partInfoPath(fullPath)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("expected '%s' to be removed", path)
+		}
+	}
+}
+
+func TestCompletePartFileWithoutKnownSizeIsDownloadedAgain(t *testing.T) {
+	pdf := minimalPdf()
+	server := newRangeServer(t, pdf)
+	url := server.URL + "/report.pdf"
+
+	directory := t.TempDir()
+	fullPath := filepath.Join(directory, "r1.pdf")
+	// Resume info from before the size was kept, so we have to find out from the server
+	writeCompletePartFile(t, fullPath, pdf, fmt.Sprintf(`{"url":%q,"etag":"\"v1\"","accept_ranges":true}`, url))
+
+	result := downloadSingleReport(t, directory, url)
+	checkDownloaded(t, result, fullPath, pdf)
+
+	if len(result.Attempts) != 2 || result.Attempts[0].StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("expected a 416 followed by a new download, got %d attempts", len(result.Attempts))
+	}
+	if server.ranges[1] != "" {
+		t.Errorf("expected the new download to not use Range, got '%s'", server.ranges[1])
+	}
+}
+
+func TestCompletePartFileWithKnownSizeIsNotResumed(t *testing.T) {
+	pdf := minimalPdf()
+	server := newRangeServer(t, pdf)
+	url := server.URL + "/report.pdf"
+
+	directory := t.TempDir()
+	fullPath := filepath.Join(directory, "r1.pdf")
+	writeCompletePartFile(t, fullPath, pdf, fmt.Sprintf(`{"url":%q,"etag":"\"v1\"","accept_ranges":true,"size":%d}`, url, len(pdf)))
+
+	result := downloadSingleReport(t, directory, url)
+	checkDownloaded(t, result, fullPath, pdf)
+
+	if len(server.ranges) != 1 || server.ranges[0] != "" {
+		t.Errorf("expected a single request without Range, got %q", server.ranges)
+	}
+}
+
+func TestFailingToMoveIntoPlaceDoesNotHang(t *testing.T) {
+	server := newRangeServer(t, minimalPdf())
+
+	directory := t.TempDir()
+	// A directory that isn't empty can't be replaced by the downloaded file
+	if err := os.MkdirAll(filepath.Join(directory, "r1.pdf", "blocker"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan *ReportDownloadResult)
+	go func() {
+		done <- downloadSingleReport(t, directory, server.URL+"/report.pdf")
+	}()
+
+	select {
+	case result := <-done:
+		if !result.State.IsFailed() {
+			t.Errorf("expected the report to fail, got state %s", result.State)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the download never finished")
+	}
+}
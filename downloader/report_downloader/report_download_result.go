@@ -2,26 +2,118 @@ package report_downloader
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
+	"github.com/F0903/pdf_downloader_uge5/downloader"
 	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader/report_download_state"
 	"github.com/F0903/pdf_downloader_uge5/models"
+	"github.com/F0903/pdf_downloader_uge5/utils"
 )
 
 // A literal "report" of the download.
 type ReportDownloadResult struct {
 	AssociatedReport *models.Report
 	State            *report_download_state.ReportDownloadState
+	// Every request made for this report, in the order they were made.
+	Attempts []*downloader.DownloadAttempt
+	// The SHA-256 hash (hex encoded) and size of the file, if we have one
+	SHA256 string
+	Size   int64
+	// The ID of the report with the same content that this was deduplicated against, if any
+	ContentDuplicateOf string
+	// The disk space saved by deduplicating this report
+	BytesSaved int64
+	// Was this carried over from an earlier run that was resumed?
+	Resumed bool
 }
 
 func (result *ReportDownloadResult) String() string {
 	resultReport := result.AssociatedReport
 	resultState := result.State
 
-	return fmt.Sprintf("[%s | %s | (%s | %s)] = %s", resultReport.Id, resultReport.Name, resultReport.PrimaryDownloadLink, resultReport.FallbackDownloadLink, resultState.String())
+	return fmt.Sprintf("[%s | %s | (%s)] = %s", resultReport.Id, resultReport.Name, strings.Join(resultReport.DownloadLinks, " | "), resultState.String())
 }
 
-func NewReportDownloadResult(associatedReport *models.Report, state *report_download_state.ReportDownloadState) *ReportDownloadResult {
+func NewReportDownloadResult(associatedReport *models.Report, state *report_download_state.ReportDownloadState, attempts []*downloader.DownloadAttempt) *ReportDownloadResult {
 	return &ReportDownloadResult{
-		associatedReport, state,
+		AssociatedReport: associatedReport,
+		State:            state,
+		Attempts:         attempts,
 	}
 }
+
+// Reads the hash and size of the file the report was written to, if we don't have them already.
+// Downloaded files are hashed while they are written, so this is only needed for files from earlier runs.
+func (result *ReportDownloadResult) readFileInfo() error {
+	if result.State.WrittenPath == "" || result.SHA256 != "" {
+		return nil
+	}
+
+	hash, size, err := utils.HashFile(result.State.WrittenPath)
+	if err != nil {
+		return err
+	}
+	result.SHA256 = hash
+	result.Size = size
+	return nil
+}
+
+// When the first request for the report was made, or the zero time if none were.
+func (result *ReportDownloadResult) StartTime() time.Time {
+	if len(result.Attempts) == 0 {
+		return time.Time{}
+	}
+	return result.Attempts[0].StartTime
+}
+
+// When the last request for the report finished, or the zero time if none were made.
+func (result *ReportDownloadResult) EndTime() time.Time {
+	if len(result.Attempts) == 0 {
+		return time.Time{}
+	}
+	return result.Attempts[len(result.Attempts)-1].EndTime
+}
+
+// The time from the first request for the report until the last one finished.
+func (result *ReportDownloadResult) Duration() time.Duration {
+	return result.EndTime().Sub(result.StartTime())
+}
+
+// The number of requests that were made before the report either succeeded or failed.
+func (result *ReportDownloadResult) AttemptCount() int {
+	return len(result.Attempts)
+}
+
+// The URL the report was downloaded from, or "" if none of them succeeded.
+func (result *ReportDownloadResult) SucceededURL() string {
+	if len(result.Attempts) == 0 {
+		return ""
+	}
+
+	// The downloader stops at the first success, so it can only be the last attempt
+	lastAttempt := result.Attempts[len(result.Attempts)-1]
+	if !lastAttempt.Succeeded() {
+		return ""
+	}
+	return lastAttempt.URL
+}
+
+// A failed URL, and the error from the last attempt on it
+type URLError struct {
+	URL string
+	Err error
+}
+
+// Returns the error of each URL that was tried and failed, in the order they were tried.
+func (result *ReportDownloadResult) URLErrors() []URLError {
+	urlErrors := make([]URLError, 0)
+	for i, attempt := range result.Attempts {
+		// Only the last attempt for each URL decides how it failed
+		isLastForURL := i+1 == len(result.Attempts) || result.Attempts[i+1].URL != attempt.URL
+		if isLastForURL && !attempt.Succeeded() {
+			urlErrors = append(urlErrors, URLError{attempt.URL, attempt.Err})
+		}
+	}
+	return urlErrors
+}
@@ -3,6 +3,8 @@ package report_download_state
 import (
 	"fmt"
 	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
 )
 
 type ReportDownloadStateEnum int
@@ -12,6 +14,11 @@ const (
 	failed
 	cancelled
 	missingURLs
+	skipped
+	notModified
+	droppedDuplicate
+	contentMismatch
+	sizeLimit
 )
 
 // This keeps track of the download state of each report,
@@ -36,6 +43,22 @@ func NewFailedState(err error) *ReportDownloadState {
 	}
 }
 
+// Every URL failed, and the last one because its content didn't match the expected hash or size
+func NewContentMismatchState(err error) *ReportDownloadState {
+	return &ReportDownloadState{
+		stateEnum: contentMismatch,
+		err:       err,
+	}
+}
+
+// Every URL failed, and the last one because the document was larger or smaller than allowed
+func NewSizeLimitState(err error) *ReportDownloadState {
+	return &ReportDownloadState{
+		stateEnum: sizeLimit,
+		err:       err,
+	}
+}
+
 func NewCancelledState() *ReportDownloadState {
 	return &ReportDownloadState{
 		stateEnum: cancelled,
@@ -48,15 +71,98 @@ func NewMissingState() *ReportDownloadState {
 	}
 }
 
+// The report was already present and valid, so it wasn't downloaded again
+func NewSkippedState(existingPath string) *ReportDownloadState {
+	return &ReportDownloadState{
+		stateEnum:   skipped,
+		WrittenPath: existingPath,
+	}
+}
+
+// The server told us the report hasn't changed since we downloaded it
+func NewNotModifiedState(existingPath string) *ReportDownloadState {
+	return &ReportDownloadState{
+		stateEnum:   notModified,
+		WrittenPath: existingPath,
+	}
+}
+
+// Another report with the same ID is downloaded instead
+func NewDroppedDuplicateState() *ReportDownloadState {
+	return &ReportDownloadState{
+		stateEnum: droppedDuplicate,
+	}
+}
+
+// Recreates the state of a report that was completed in an earlier run, from its name and the path it was written to.
+// Returns false if the state wasn't one where we have a valid copy of the report.
+func ParseCompletedState(name string, writtenPath string) (*ReportDownloadState, bool) {
+	for _, state := range []*ReportDownloadState{NewSuccededState(writtenPath), NewSkippedState(writtenPath), NewNotModifiedState(writtenPath)} {
+		if state.Name() == name {
+			return state, true
+		}
+	}
+	return nil, false
+}
+
 // Has the download succeded?
 func (state *ReportDownloadState) IsDone() bool {
 	return state.stateEnum == done
 }
 
-// Set the error and set stateEnum to failed
-func (state *ReportDownloadState) SetError(err error) {
-	state.stateEnum = failed
-	state.err = err
+// Did all of the URLs fail?
+func (state *ReportDownloadState) IsFailed() bool {
+	return state.stateEnum == failed || state.stateEnum == contentMismatch || state.stateEnum == sizeLimit
+}
+
+func (state *ReportDownloadState) IsCancelled() bool {
+	return state.stateEnum == cancelled
+}
+
+// Did the report not have any URLs to download from?
+func (state *ReportDownloadState) IsMissingURLs() bool {
+	return state.stateEnum == missingURLs
+}
+
+// Was the report left out because another report has the same ID?
+func (state *ReportDownloadState) IsDroppedDuplicate() bool {
+	return state.stateEnum == droppedDuplicate
+}
+
+// Was the download skipped because we already had the report?
+func (state *ReportDownloadState) IsSkipped() bool {
+	return state.stateEnum == skipped || state.stateEnum == notModified
+}
+
+// A stable code for why the download didn't succeed, or ErrorCodeNone if it did.
+func (state *ReportDownloadState) ErrorCode() downloader.ErrorCode {
+	switch state.stateEnum {
+	case failed, contentMismatch, sizeLimit:
+		return downloader.ClassifyError(state.err)
+	case cancelled:
+		return downloader.ErrorCodeCancelled
+	case missingURLs:
+		return downloader.ErrorCodeMissingURL
+	}
+	return downloader.ErrorCodeNone
+}
+
+// The error the download failed with, if it failed
+func (state *ReportDownloadState) Err() error {
+	return state.err
+}
+
+// The name of the state, without any error details, so results can be grouped by it.
+func (state *ReportDownloadState) Name() string {
+	switch state.stateEnum {
+	case failed:
+		return "Failed"
+	case contentMismatch:
+		return "Content mismatch"
+	case sizeLimit:
+		return "Outside size limits"
+	}
+	return state.String()
 }
 
 func (state *ReportDownloadState) String() string {
@@ -67,8 +173,18 @@ func (state *ReportDownloadState) String() string {
 		return "Cancelled"
 	case failed:
 		return fmt.Sprintf("Error: %v", state.err)
+	case contentMismatch:
+		return fmt.Sprintf("Content mismatch: %v", state.err)
+	case sizeLimit:
+		return fmt.Sprintf("Outside size limits: %v", state.err)
 	case missingURLs:
 		return "Missing URLs"
+	case skipped:
+		return "Already present"
+	case notModified:
+		return "Not modified"
+	case droppedDuplicate:
+		return "Duplicate ID"
 	}
 	return "Unknown DownloadState"
 }
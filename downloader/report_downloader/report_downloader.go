@@ -2,11 +2,15 @@ package report_downloader
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
-	"path"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"github.com/F0903/pdf_downloader_uge5/downloader"
@@ -17,9 +21,30 @@ import (
 	"github.com/vbauerster/mpb/v8/decor"
 )
 
+// The amount of reports that are downloaded at the same time, unless otherwise specified.
+const DefaultConcurrency = 10
+
+// Is called with the result of each report as soon as it's done, in the order they finish.
+// Calls are never made at the same time, so the handler doesn't have to be thread safe.
+type ResultHandler = func(*ReportDownloadResult)
+
+// Returned when the server tells us the document hasn't changed since we downloaded it.
+var errNotModified = errors.New("not modified")
+
 type ReportDownloader struct {
 	*downloader.Downloader
-	outputDir string
+	outputDir       string
+	concurrency     int
+	incrementalMode IncrementalMode
+	quarantineDir   string
+	filename        *FilenameTemplate
+	dedupeMode      DedupeMode
+	sizeLimits      SizeLimits
+	contents        *contentIndex
+	validators      *validatorStore
+	resultHandler   ResultHandler
+	// Results of an earlier run that we are resuming, by report ID
+	resumedResults map[string]*ReportDownloadResult
 }
 
 func isPdf(contentType string) bool {
@@ -28,8 +53,13 @@ func isPdf(contentType string) bool {
 
 // The response asserter for the report downloader
 func ReportDownloaderResponseAsserter(resp *http.Response) error {
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("status code was not OK: %d", resp.StatusCode)
+	// Not Modified only happens when we revalidate a document, and it has no body to check
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return downloader.NewStatusError(resp)
 	}
 
 	contentType := resp.Header.Get("Content-Type")
@@ -37,128 +67,527 @@ func ReportDownloaderResponseAsserter(resp *http.Response) error {
 	if contentType == "" {
 		return nil
 	} else if !isPdf(contentType) {
-		return errors.New("resource Content-Type is not PDF")
+		return downloader.NewDownloadError(downloader.ErrorCodeWrongContentType, errors.New("resource Content-Type is not PDF"))
 	}
 
 	return nil
 }
 
 func NewReportDownloader(ctx context.Context, outputDir string) *ReportDownloader {
-	dl := downloader.NewDownloader(ctx)
-	dl.SetResponseAsserter(ReportDownloaderResponseAsserter)
-	return &ReportDownloader{
-		Downloader: dl,
-		outputDir:  outputDir,
+	filename, _ := ParseFilenameTemplate(DefaultFilenameTemplate)
+	dl := &ReportDownloader{
+		Downloader:  downloader.NewDownloader(ctx),
+		outputDir:   outputDir,
+		concurrency: DefaultConcurrency,
+		filename:    filename,
 	}
+	dl.SetResponseAsserter(dl.assertResponse)
+	return dl
+}
+
+// Sets the maximum amount of reports that are downloaded at the same time.
+func (dl *ReportDownloader) SetConcurrency(concurrency int) {
+	dl.concurrency = max(concurrency, 1)
+}
+
+// Sets what to do with reports that are already present in the output directory.
+func (dl *ReportDownloader) SetIncrementalMode(mode IncrementalMode) {
+	dl.incrementalMode = mode
 }
 
-func (dl *ReportDownloader) writeResponseToFileWithProgress(data *downloader.DownloadData, fullPath string, progressBar *mpb.Bar) error {
-	// Create the download file
-	file, err := os.Create(fullPath)
+// Sets the directory that downloads which fail validation are moved to.
+// If empty, which is the default, they are deleted instead.
+func (dl *ReportDownloader) SetQuarantineDir(dir string) {
+	dl.quarantineDir = dir
+}
+
+// Sets the template that decides where in the output directory each report is saved.
+func (dl *ReportDownloader) SetFilenameTemplate(template *FilenameTemplate) {
+	dl.filename = template
+}
+
+// Sets what to do with reports that have the same content as another report.
+func (dl *ReportDownloader) SetDedupeMode(mode DedupeMode) {
+	dl.dedupeMode = mode
+}
+
+// Sets the smallest and largest a document can be. Documents outside the limits fail, and the next URL is tried.
+func (dl *ReportDownloader) SetSizeLimits(limits SizeLimits) {
+	dl.sizeLimits = limits
+}
+
+// Sets the handler that is called with each result as soon as the report is done,
+// so the results can be saved before the whole run has finished.
+func (dl *ReportDownloader) SetResultHandler(handler ResultHandler) {
+	dl.resultHandler = handler
+}
+
+// Checks that the file of a result from an earlier run is still there, and still has the hash it was written with.
+func resumedFileIsIntact(result *ReportDownloadResult) bool {
+	if result.State.WrittenPath == "" || result.SHA256 == "" {
+		return false
+	}
+
+	hash, size, err := utils.HashFile(result.State.WrittenPath)
+	return err == nil && hash == result.SHA256 && size == result.Size
+}
+
+// Sets the completed results of an earlier run, so the reports they belong to aren't downloaded again.
+// The results are only used if their file is still there and unchanged, otherwise the report is downloaded again.
+func (dl *ReportDownloader) SetResumedResults(results []*ReportDownloadResult) {
+	dl.resumedResults = make(map[string]*ReportDownloadResult, len(results))
+	changed := 0
+	for _, result := range results {
+		if !resumedFileIsIntact(result) {
+			changed++
+			continue
+		}
+		dl.resumedResults[result.AssociatedReport.Id] = result
+	}
+
+	if changed > 0 {
+		fmt.Printf("%d documents from the earlier run are missing or have changed since, and will be downloaded again.\n", changed)
+	}
+}
+
+// Returns the result from the earlier run, if the report was completed in it.
+func (dl *ReportDownloader) resumedResult(report *models.Report) (*ReportDownloadResult, bool) {
+	result, ok := dl.resumedResults[report.Id]
+	if !ok {
+		return nil, false
+	}
+
+	// The expected hash or size may have been added to the input since
+	if checkExpectedContent(report, downloadedFile{result.SHA256, result.Size}) != nil {
+		return nil, false
+	}
+
+	// The report may have been read from a different row this time
+	result.AssociatedReport = report
+	result.Resumed = true
+	return result, true
+}
+
+func (dl *ReportDownloader) prepareReportRequest(report *models.Report, fullDownloadPath string, revalidate bool) downloader.RequestPreparer {
+	stored, hasValidators := dl.validators.get(report.Id)
+	conditional := revalidate && hasValidators && !stored.isEmpty()
+
+	return func(url string, req *http.Request) error {
+		addResumeHeaders(fullDownloadPath, url, req)
+		if conditional {
+			addConditionalHeaders(url, req, stored.resourceValidators)
+		}
+		return nil
+	}
+}
+
+// Opens the .part file for the download, either appending to it if the server resumed where we left off,
+// or truncating it if the server sent the whole thing.
+// Returns the file and the offset it will be written from.
+func openPartFile(data *downloader.DownloadData, fullPath string) (*os.File, int64, error) {
+	partPath := partFilePath(fullPath)
+
+	if !data.IsPartial() {
+		file, err := os.Create(partPath)
+		return file, 0, err
+	}
+
+	offset, err := parseContentRangeStart(data.Header.Get("Content-Range"))
+	if err != nil {
+		removePartialDownload(fullPath)
+		return nil, 0, err
+	}
+
+	stat, err := os.Stat(partPath)
+	if err != nil || stat.Size() != offset {
+		// This shouldn't happen, but if it does we start over next attempt
+		removePartialDownload(fullPath)
+		return nil, 0, fmt.Errorf("server resumed from byte %d, which does not match the partial download", offset)
+	}
+
+	file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0644)
+	return file, offset, err
+}
+
+// The hash and size of a downloaded file, found while it was written
+type downloadedFile struct {
+	sha256 string
+	size   int64
+}
+
+// Feeds the part of the file we already have to the hash, so resumed downloads get the hash of the whole file.
+func hashPartFile(partPath string, length int64, hash io.Writer) error {
+	file, err := os.Open(partPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.CopyN(hash, file, length)
+	return err
+}
+
+// Writes the response to the .part file, and returns the hash and size of the whole file.
+func (dl *ReportDownloader) writeResponseToFileWithProgress(data *downloader.DownloadData, fullPath string, progressBar *mpb.Bar) (downloadedFile, error) {
+	// The filename template can put reports in sub directories
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return downloadedFile{}, fmt.Errorf("could not create directory: %w", err)
+	}
+
+	// Remember where this came from, so we can resume it if we get interrupted
+	if err := newPartialDownload(data).save(fullPath); err != nil {
+		return downloadedFile{}, fmt.Errorf("could not save resume info: %w", err)
+	}
+
+	// Create or reopen the download file
+	file, offset, err := openPartFile(data, fullPath)
 	if err != nil {
-		return fmt.Errorf("could not create file: %w", err)
+		return downloadedFile{}, fmt.Errorf("could not create file: %w", err)
 	}
 	defer file.Close()
 
 	contentLength := data.ContentLength
 	reader := data.Reader
-	defer reader.Close()
 
-	// Set the "finsihed value" for our progress bar to the content length of the response
+	// Set the "finsihed value" for our progress bar to the content length of the response,
+	// and start it from however much we already had.
+	// This also resets the bar in case this is a retry.
+	if contentLength >= 0 {
+		contentLength += offset
+	}
 	progressBar.SetTotal(contentLength, false)
+	progressBar.SetCurrent(offset)
 
 	// Proxy reader automatically increments our progress bar
 	proxyReader := progressBar.ProxyReader(reader)
 	defer proxyReader.Close()
 
+	// Hash while we write, so we don't have to read the file again afterwards
+	hash := sha256.New()
+	if offset > 0 {
+		if err := hashPartFile(partFilePath(fullPath), offset, hash); err != nil {
+			return downloadedFile{}, fmt.Errorf("could not hash partial download: %w", err)
+		}
+	}
+
 	// Read from response and write to file whilst updating the progress bar
-	if _, err := utils.CancellableCopy(dl.Ctx, file, proxyReader); err != nil {
+	written, err := utils.CancellableCopy(dl.Ctx, io.MultiWriter(file, hash), newMaxSizeReader(proxyReader, offset, dl.sizeLimits))
+	if err != nil {
 		if err == context.Canceled {
-			return err
+			return downloadedFile{}, err
 		}
-		return fmt.Errorf("could not write to file: %w", err)
+		return downloadedFile{}, fmt.Errorf("could not write to file: %w", err)
 	}
 
-	return nil
+	if offset+written == 0 {
+		return downloadedFile{}, downloader.NewDownloadError(downloader.ErrorCodeEmptyBody, errors.New("response body was empty"))
+	}
+	if err := dl.sizeLimits.check(offset + written); err != nil {
+		return downloadedFile{}, err
+	}
+
+	return downloadedFile{hex.EncodeToString(hash.Sum(nil)), offset + written}, nil
 }
 
-func (dl *ReportDownloader) downloadResourceWithProgress(report *models.Report, fullDownloadPath string, progressBar *mpb.Bar) error {
-	data, err := dl.Download(report)
+func (dl *ReportDownloader) downloadResourceWithProgress(report *models.Report, fullDownloadPath string, revalidate bool, progressBar *mpb.Bar) ([]*downloader.DownloadAttempt, downloadedFile, error) {
+	var validators resourceValidators
+	var file downloadedFile
+	notModified := false
+
+	prepare := dl.prepareReportRequest(report, fullDownloadPath, revalidate)
+	handler := func(data *downloader.DownloadData) error {
+		if data.StatusCode == http.StatusNotModified {
+			notModified = true
+			return nil
+		}
+
+		// No need to download it if the server already tells us it's the wrong size
+		if !data.IsPartial() {
+			if err := checkExpectedSize(report, data.ContentLength); err != nil {
+				return err
+			}
+		}
+
+		written, err := dl.writeResponseToFileWithProgress(data, fullDownloadPath, progressBar)
+		switch downloader.ClassifyError(err) {
+		case downloader.ErrorCodeNone:
+		case downloader.ErrorCodeTooLarge:
+			// Not worth keeping, neither for resuming nor for inspection
+			removePartialDownload(fullDownloadPath)
+			return fmt.Errorf("could not write response to file: %w", err)
+		case downloader.ErrorCodeTooSmall:
+			return errors.Join(fmt.Errorf("could not write response to file: %w", err), discardPartialDownload(fullDownloadPath, dl.quarantineDir))
+		default:
+			return fmt.Errorf("could not write response to file: %w", err)
+		}
+
+		// Validate before it is moved into place, so we never leave a broken PDF in the output directory.
+		// Failing here means we move on to the next URL.
+		if err := ValidatePdf(partFilePath(fullDownloadPath)); err != nil {
+			validationErr := downloader.NewDownloadError(downloader.ErrorCodeInvalidPDF, fmt.Errorf("could not validate PDF: %w", err))
+			return errors.Join(validationErr, discardPartialDownload(fullDownloadPath, dl.quarantineDir))
+		}
+
+		// A valid PDF can still be the wrong document, e.g. a newer version than the one that was published
+		if err := checkExpectedContent(report, written); err != nil {
+			return errors.Join(err, discardPartialDownload(fullDownloadPath, dl.quarantineDir))
+		}
+
+		validators = newResourceValidators(data)
+		file = written
+		return nil
+	}
+
+	attempts, err := dl.Download(report, prepare, handler)
+	// A .part file that already has every byte can't be resumed, so we throw it away and start over
+	if partial, _ := loadPartialDownload(fullDownloadPath); partial != nil && isRangeNotSatisfiable(err) {
+		removePartialDownload(fullDownloadPath)
+		var retryAttempts []*downloader.DownloadAttempt
+		retryAttempts, err = dl.Download(report, prepare, handler)
+		attempts = append(attempts, retryAttempts...)
+	}
 	if err != nil {
+		// The .part file is only left behind if the download can be resumed next time
+		if !isResumable(fullDownloadPath) {
+			err = errors.Join(err, discardPartialDownload(fullDownloadPath, dl.quarantineDir))
+		}
+
 		progressBar.Abort(true)
-		return fmt.Errorf("download error: %w", err)
+		if errors.Is(err, context.Canceled) {
+			return attempts, file, context.Canceled
+		}
+		return attempts, file, fmt.Errorf("download error: %w", err)
 	}
 
-	if err := dl.writeResponseToFileWithProgress(data, fullDownloadPath, progressBar); err != nil {
-		return fmt.Errorf("could not write response to file: %w", err)
+	if notModified {
+		progressBar.Abort(true)
+		return attempts, file, errNotModified
 	}
 
-	return nil
+	if err := finishPartialDownload(fullDownloadPath); err != nil {
+		progressBar.Abort(true)
+		return attempts, file, err
+	}
+
+	dl.validators.set(report.Id, validators)
+	return attempts, file, nil
 }
 
-func (dl *ReportDownloader) downloadReportWithProgress(report *models.Report, fullDownloadPath string, progressBar *mpb.Bar) *ReportDownloadResult {
-	// Exit early if we are missing both URLs
-	if report.PrimaryDownloadLink == "" && report.FallbackDownloadLink == "" {
+// present is the copy we already have from an earlier run, if any, which is revalidated instead of downloaded again.
+func (dl *ReportDownloader) downloadReportWithProgress(report *models.Report, fullDownloadPath string, present *presentCopy, progressBar *mpb.Bar) *ReportDownloadResult {
+	// Exit early if we don't have any URLs
+	if len(report.GetDownloadableURLs()) == 0 {
 		progressBar.Abort(true)
-		return NewReportDownloadResult(report, report_download_state.NewMissingState())
+		return NewReportDownloadResult(report, report_download_state.NewMissingState(), nil)
 	}
 
-	err := dl.downloadResourceWithProgress(report, fullDownloadPath, progressBar)
+	attempts, file, err := dl.downloadResourceWithProgress(report, fullDownloadPath, present != nil, progressBar)
 	if err != nil {
+		if err == errNotModified {
+			return present.result(report, report_download_state.NewNotModifiedState(present.path), attempts)
+		}
+
 		if err == context.Canceled {
-			return NewReportDownloadResult(report, report_download_state.NewCancelledState())
+			return NewReportDownloadResult(report, report_download_state.NewCancelledState(), attempts)
+		}
+
+		switch downloader.ClassifyError(err) {
+		case downloader.ErrorCodeSizeMismatch, downloader.ErrorCodeChecksumMismatch:
+			return NewReportDownloadResult(report, report_download_state.NewContentMismatchState(err), attempts)
+		case downloader.ErrorCodeTooLarge, downloader.ErrorCodeTooSmall:
+			return NewReportDownloadResult(report, report_download_state.NewSizeLimitState(err), attempts)
 		}
 
 		// If the error was not that the download has been cancelled, just return a generic error state
-		return NewReportDownloadResult(report, report_download_state.NewFailedState(err))
+		return NewReportDownloadResult(report, report_download_state.NewFailedState(err), attempts)
 	}
 
 	progressBar.SetTotal(progressBar.Current(), true)
-	return NewReportDownloadResult(report, report_download_state.NewSuccededState(fullDownloadPath))
+	result := NewReportDownloadResult(report, report_download_state.NewSuccededState(fullDownloadPath), attempts)
+	result.SHA256 = file.sha256
+	result.Size = file.size
+	return result
+}
+
+func addReportProgressBar(p *mpb.Progress, name string) *mpb.Bar {
+	return p.AddBar(0,
+		mpb.PrependDecorators(
+			decor.Name(name, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
+		),
+		mpb.AppendDecorators(
+			decor.OnAbort(decor.AverageETA(decor.ET_STYLE_GO, decor.WC{C: decor.DindentRight | decor.DextraSpace}), ""),
+			decor.OnAbort(
+				decor.Percentage(),
+				"stopping...",
+			),
+		),
+		mpb.BarRemoveOnComplete(),
+	)
 }
 
-// Download all reports concurrently
+func addTotalProgressBar(p *mpb.Progress, total int) *mpb.Bar {
+	return p.AddBar(int64(total),
+		mpb.PrependDecorators(
+			decor.Name("Total", decor.WC{C: decor.DindentRight | decor.DextraSpace}),
+			decor.CountersNoUnit("%d / %d", decor.WC{C: decor.DindentRight | decor.DextraSpace}),
+		),
+		mpb.AppendDecorators(
+			decor.Percentage(),
+		),
+	)
+}
+
+func (dl *ReportDownloader) downloadReport(p *mpb.Progress, report *models.Report, fullDownloadPath string) *ReportDownloadResult {
+	if result, ok := dl.resumedResult(report); ok {
+		return result
+	}
+
+	// No need to make a progress bar for all the queued reports if the user has already cancelled
+	if dl.Ctx.Err() != nil {
+		return NewReportDownloadResult(report, report_download_state.NewCancelledState(), nil)
+	}
+
+	// Check if we already have a good copy of the report from an earlier run
+	present, alreadyPresent := dl.findPresentCopy(report, fullDownloadPath)
+	if alreadyPresent && dl.incrementalMode == IncrementalSkip {
+		return present.result(report, report_download_state.NewSkippedState(present.path), nil)
+	}
+
+	progressBar := addReportProgressBar(p, filepath.Base(fullDownloadPath))
+	return dl.downloadReportWithProgress(report, fullDownloadPath, present, progressBar)
+}
+
+// Finds the path of each report, and fails every report but the first that would be saved to the same file,
+// since they would otherwise overwrite each other.
+// Returns the paths, and the results of the reports that failed.
+func (dl *ReportDownloader) planDownloadPaths(reports []*models.Report) ([]string, map[int]*ReportDownloadResult) {
+	paths := make([]string, len(reports))
+	duplicates := make(map[int]*ReportDownloadResult)
+	// Windows and most network shares don't care about case, so neither do we
+	firstWithPath := make(map[string]*models.Report)
+
+	for i, report := range reports {
+		relativePath := dl.filename.RelativePath(report)
+		paths[i] = filepath.Join(dl.outputDir, filepath.FromSlash(relativePath))
+		// Blank rows have nothing to download, and reports without an ID aren't told apart, just like with duplicate IDs
+		if report.DroppedAsDuplicate || report.Id == "" || len(report.GetDownloadableURLs()) == 0 {
+			continue
+		}
+
+		key := strings.ToLower(relativePath)
+		first, exists := firstWithPath[key]
+		if !exists {
+			firstWithPath[key] = report
+			continue
+		}
+
+		err := downloader.NewDownloadError(downloader.ErrorCodeDuplicatePath, fmt.Errorf("'%s' is already the file of report '%s'", relativePath, first.Id))
+		duplicates[i] = NewReportDownloadResult(report, report_download_state.NewFailedState(err), nil)
+	}
+
+	if len(duplicates) > 0 {
+		fmt.Printf("%d reports have the same file path as another report, and will not be downloaded!\n", len(duplicates))
+	}
+
+	return paths, duplicates
+}
+
+// Download all reports concurrently, with at most the configured number of downloads in flight.
+// The results are returned in the same order as the reports.
 func (dl *ReportDownloader) DownloadReports(reports []*models.Report) []*ReportDownloadResult {
 	results := make([]*ReportDownloadResult, len(reports))
+	paths, duplicates := dl.planDownloadPaths(reports)
+
+	validators, err := loadValidatorStore(dl.outputDir)
+	if err != nil {
+		fmt.Printf("Could not load validators from earlier runs, documents will be downloaded again!\n%v\n", err)
+		validators = newValidatorStore(dl.outputDir)
+	}
+	dl.validators = validators
+
+	// Files from a resumed run can be the originals of files downloaded in this one
+	dl.contents = newContentIndex()
+	for _, result := range dl.resumedResults {
+		if result.SHA256 != "" && result.ContentDuplicateOf == "" {
+			dl.contents.claim(result)
+		}
+	}
 
 	var wg sync.WaitGroup
 	p := mpb.New(
 		mpb.WithWaitGroup(&wg),
 		mpb.WithAutoRefresh(),
 	)
+	totalBar := addTotalProgressBar(p, len(reports))
 
-	for i, report := range reports {
-		wg.Add(1)
+	// The queue just holds indices into reports, so each worker knows where to put its result.
+	// Makes sure the result handler is only called by one worker at a time
+	var resultHandlerMutex sync.Mutex
 
-		fileName := report.Id
-		fullDownloadPath := path.Join(dl.outputDir, fileName+".pdf")
+	queue := make(chan int)
+	go func() {
+		defer close(queue)
+		for i := range reports {
+			queue <- i
+		}
+	}()
 
-		// It's important to create the progress bar here and not in the new thread or it will panic
-		progressBar := p.AddBar(0,
-			mpb.PrependDecorators(
-				decor.Name(fileName, decor.WC{C: decor.DindentRight | decor.DextraSpace}),
-			),
-			mpb.AppendDecorators(
-				decor.OnAbort(decor.AverageETA(decor.ET_STYLE_GO, decor.WC{C: decor.DindentRight | decor.DextraSpace}), ""),
-				decor.OnAbort(
-					decor.Percentage(),
-					"stopping...",
-				),
-			),
-			mpb.BarRemoveOnComplete(),
-		)
+	workerCount := min(dl.concurrency, len(reports))
+	for range workerCount {
+		wg.Add(1)
 
-		// Start new thread for each download
+		// Progress bars are only created by the workers, so we only ever have one per in-flight download.
+		// This is safe since the total bar only completes once every report is done, and p.Wait() waits for all bars
+		// to complete before it stops accepting new ones, so p is still running whenever a worker adds a bar.
 		go func() {
 			defer wg.Done()
-			result := dl.downloadReportWithProgress(report, fullDownloadPath, progressBar)
-			ValidateDownloadResult(result)
+			for i := range queue {
+				// Since each index is only handed to one worker this is thread safe, and also preserves the order.
+				result, isDuplicate := duplicates[i]
+				if reports[i].DroppedAsDuplicate {
+					result = NewReportDownloadResult(reports[i], report_download_state.NewDroppedDuplicateState(), nil)
+				} else if !isDuplicate {
+					result = dl.downloadReport(p, reports[i], paths[i])
+				}
+				results[i] = result
+				totalBar.Increment()
+
+				// Resumed results are already complete, and have already been handled in the earlier run
+				if result.Resumed {
+					continue
+				}
 
-			// Since each thread has a unique index this is thread safe, and also preserves the order.
-			results[i] = result
+				if err := result.readFileInfo(); err != nil {
+					fmt.Printf("Could not hash '%s'!\n%v\n", result.State.WrittenPath, err)
+				}
+				if err := dl.dedupeResult(result); err != nil {
+					fmt.Printf("Could not deduplicate '%s'!\n%v\n", result.State.WrittenPath, err)
+				}
+				dl.recordContent(result, paths[i])
+
+				if dl.resultHandler != nil {
+					resultHandlerMutex.Lock()
+					dl.resultHandler(result)
+					resultHandlerMutex.Unlock()
+				}
+				// Like the journal, so an interrupted run doesn't forget what it downloaded
+				if err := dl.validators.saveIfDue(); err != nil {
+					fmt.Printf("Could not save validators!\n%v\n", err)
+				}
+			}
 		}()
 	}
 
+	// Make sure the total bar completes even when there were no reports to download
+	if workerCount == 0 {
+		totalBar.SetTotal(0, true)
+	}
+
 	p.Wait()
+
+	if err := dl.validators.save(); err != nil {
+		fmt.Printf("Could not save validators!\n%v\n", err)
+	}
+
 	return results
 }
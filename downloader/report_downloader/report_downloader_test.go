@@ -0,0 +1,20 @@
+package report_downloader
+
+import (
+	"context"
+	"testing"
+
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+func TestBlankRowsAreMissingURLs(t *testing.T) {
+	dl := NewReportDownloader(context.Background(), t.TempDir())
+	defer dl.Close()
+
+	reports := []*models.Report{{SourceRow: 2}, {SourceRow: 3}, {SourceRow: 4}}
+	for _, result := range dl.DownloadReports(reports) {
+		if !result.State.IsMissingURLs() {
+			t.Errorf("expected row %d to be missing URLs, got state %s", result.AssociatedReport.SourceRow, result.State)
+		}
+	}
+}
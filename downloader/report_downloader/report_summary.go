@@ -0,0 +1,206 @@
+package report_downloader
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+// How many of the slowest downloads are included in the summary
+const slowestDownloadCount = 5
+
+// How many times something happened, like a state or an error code
+type NamedCount struct {
+	Name  string
+	Count int
+}
+
+// The requests made to a single host
+type HostSummary struct {
+	Host          string
+	Requests      int
+	Failures      int
+	BytesReceived int64
+}
+
+// How long a successful download took, from the first request for the report until it was done
+type SlowDownload struct {
+	ReportId      string
+	URL           string
+	Duration      time.Duration
+	BytesReceived int64
+}
+
+// Statistics for a whole run.
+// All the lists are sorted with the largest first, so they can be printed as is.
+type ReportSummary struct {
+	StartTime    time.Time
+	EndTime      time.Time
+	TotalReports int
+	// Reports that were completed in an earlier run that this one resumed. They are counted in the states,
+	// but the requests and bytes of the earlier run aren't part of this one, so they are left out of the rest.
+	ResumedReports int
+	States         []NamedCount
+	// Only failed, cancelled and missing reports have an error code
+	ErrorCodes []NamedCount
+	Hosts      []HostSummary
+	// All bytes received, including from attempts that failed
+	BytesReceived    int64
+	SlowestDownloads []SlowDownload
+	// Reports whose file was deduplicated against another with the same content, and the disk space it saved
+	DedupedReports int
+	BytesSaved     int64
+}
+
+func sortedCounts(counts map[string]int) []NamedCount {
+	sorted := make([]NamedCount, 0, len(counts))
+	for name, count := range counts {
+		sorted = append(sorted, NamedCount{name, count})
+	}
+	slices.SortFunc(sorted, func(a, b NamedCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Name, b.Name))
+	})
+	return sorted
+}
+
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return "(invalid URL)"
+	}
+	return parsed.Hostname()
+}
+
+// Collects the statistics of the results. The start and end time are those of the whole run.
+func SummarizeResults(results []*ReportDownloadResult, startTime time.Time, endTime time.Time) *ReportSummary {
+	summary := &ReportSummary{
+		StartTime:    startTime,
+		EndTime:      endTime,
+		TotalReports: len(results),
+	}
+
+	states := make(map[string]int)
+	errorCodes := make(map[string]int)
+	hosts := make(map[string]*HostSummary)
+	slowest := make([]SlowDownload, 0)
+
+	for _, result := range results {
+		states[result.State.Name()]++
+		if code := result.State.ErrorCode(); code != downloader.ErrorCodeNone {
+			errorCodes[string(code)]++
+		}
+
+		if result.Resumed {
+			summary.ResumedReports++
+			continue
+		}
+
+		for _, attempt := range result.Attempts {
+			host := hostOf(attempt.URL)
+			hostSummary, ok := hosts[host]
+			if !ok {
+				hostSummary = &HostSummary{Host: host}
+				hosts[host] = hostSummary
+			}
+			hostSummary.Requests++
+			if !attempt.Succeeded() {
+				hostSummary.Failures++
+			}
+			hostSummary.BytesReceived += attempt.BytesReceived
+			summary.BytesReceived += attempt.BytesReceived
+		}
+
+		if result.ContentDuplicateOf != "" {
+			summary.DedupedReports++
+			summary.BytesSaved += result.BytesSaved
+		}
+
+		if result.State.IsDone() && len(result.Attempts) > 0 {
+			last := result.Attempts[len(result.Attempts)-1]
+			slowest = append(slowest, SlowDownload{
+				ReportId:      result.AssociatedReport.Id,
+				URL:           last.URL,
+				Duration:      result.Duration(),
+				BytesReceived: last.BytesReceived,
+			})
+		}
+	}
+
+	summary.States = sortedCounts(states)
+	summary.ErrorCodes = sortedCounts(errorCodes)
+
+	summary.Hosts = make([]HostSummary, 0, len(hosts))
+	for _, hostSummary := range hosts {
+		summary.Hosts = append(summary.Hosts, *hostSummary)
+	}
+	slices.SortFunc(summary.Hosts, func(a, b HostSummary) int {
+		return cmp.Or(cmp.Compare(b.Requests, a.Requests), cmp.Compare(a.Host, b.Host))
+	})
+
+	slices.SortFunc(slowest, func(a, b SlowDownload) int {
+		return cmp.Compare(b.Duration, a.Duration)
+	})
+	summary.SlowestDownloads = slowest[:min(len(slowest), slowestDownloadCount)]
+
+	return summary
+}
+
+func (summary *ReportSummary) Duration() time.Duration {
+	return summary.EndTime.Sub(summary.StartTime)
+}
+
+// The average bytes received per second over the whole run
+func (summary *ReportSummary) Throughput() float64 {
+	seconds := summary.Duration().Seconds()
+	if seconds <= 0 {
+		return 0
+	}
+	return float64(summary.BytesReceived) / seconds
+}
+
+// Prints the summary in a human readable form.
+func (summary *ReportSummary) Print(w io.Writer) {
+	fmt.Fprintf(w, "Started:  %s\n", summary.StartTime.Format(time.DateTime))
+	fmt.Fprintf(w, "Finished: %s\n", summary.EndTime.Format(time.DateTime))
+	fmt.Fprintf(w, "Time taken: %s\n", summary.Duration().Round(time.Second))
+	fmt.Fprintf(w, "Reports: %d\n", summary.TotalReports)
+	if summary.ResumedReports > 0 {
+		fmt.Fprintf(w, "  (of which %d were completed in the earlier run that was resumed)\n", summary.ResumedReports)
+	}
+	for _, state := range summary.States {
+		fmt.Fprintf(w, "  %s: %d\n", state.Name, state.Count)
+	}
+
+	if len(summary.ErrorCodes) > 0 {
+		fmt.Fprintln(w, "Errors:")
+		for _, code := range summary.ErrorCodes {
+			fmt.Fprintf(w, "  %s: %d\n", code.Name, code.Count)
+		}
+	}
+
+	fmt.Fprintf(w, "Downloaded: %s (%s/s)\n", utils.FormatBytes(summary.BytesReceived), utils.FormatBytes(int64(summary.Throughput())))
+
+	if summary.DedupedReports > 0 {
+		fmt.Fprintf(w, "Deduplicated: %d documents, saving %s\n", summary.DedupedReports, utils.FormatBytes(summary.BytesSaved))
+	}
+
+	if len(summary.Hosts) > 0 {
+		fmt.Fprintln(w, "Hosts:")
+		for _, host := range summary.Hosts {
+			fmt.Fprintf(w, "  %s: %d requests, %d failed, %s\n", host.Host, host.Requests, host.Failures, utils.FormatBytes(host.BytesReceived))
+		}
+	}
+
+	if len(summary.SlowestDownloads) > 0 {
+		fmt.Fprintln(w, "Slowest downloads:")
+		for _, slow := range summary.SlowestDownloads {
+			fmt.Fprintf(w, "  %s: %s (%s) from %s\n", slow.ReportId, slow.Duration.Round(time.Millisecond), utils.FormatBytes(slow.BytesReceived), slow.URL)
+		}
+	}
+}
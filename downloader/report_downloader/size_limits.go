@@ -0,0 +1,82 @@
+package report_downloader
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+// The smallest and largest a document can be, in bytes. 0 means no limit.
+type SizeLimits struct {
+	MinBytes int64
+	MaxBytes int64
+}
+
+// Used while streaming, where we don't know the full size yet
+func tooLargeError(limits SizeLimits) error {
+	return downloader.NewDownloadError(downloader.ErrorCodeTooLarge, fmt.Errorf("document is larger than the maximum size of %s", utils.FormatBytes(limits.MaxBytes)))
+}
+
+// Checks the full size of a document against the limits.
+// A negative size means we don't know it, which is never outside the limits.
+func (limits SizeLimits) check(size int64) error {
+	if limits.MaxBytes > 0 && size > limits.MaxBytes {
+		return downloader.NewDownloadError(downloader.ErrorCodeTooLarge, fmt.Errorf("document is %s, which is larger than the maximum size of %s", utils.FormatBytes(size), utils.FormatBytes(limits.MaxBytes)))
+	}
+	if limits.MinBytes > 0 && size >= 0 && size < limits.MinBytes {
+		return downloader.NewDownloadError(downloader.ErrorCodeTooSmall, fmt.Errorf("document is %s, which is smaller than the minimum size of %s", utils.FormatBytes(size), utils.FormatBytes(limits.MinBytes)))
+	}
+	return nil
+}
+
+// The full size of the document in the response, or -1 if the server didn't tell us.
+func responseDocumentSize(resp *http.Response) int64 {
+	return documentSize(resp.StatusCode == http.StatusPartialContent, resp.ContentLength, resp.Header.Get("Content-Range"))
+}
+
+// Checks the size the server says the document has, so we don't start downloading something we will throw away anyway.
+func (dl *ReportDownloader) assertResponse(resp *http.Response) error {
+	if err := ReportDownloaderResponseAsserter(resp); err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	return dl.sizeLimits.check(responseDocumentSize(resp))
+}
+
+// Fails the read as soon as the document grows larger than the maximum size,
+// since Content-Length can be missing or wrong.
+type maxSizeReader struct {
+	reader io.Reader
+	// How much more can be read before the document is too large
+	remaining int64
+	limits    SizeLimits
+}
+
+func newMaxSizeReader(reader io.Reader, offset int64, limits SizeLimits) io.Reader {
+	if limits.MaxBytes <= 0 {
+		return reader
+	}
+	return &maxSizeReader{reader, limits.MaxBytes - offset, limits}
+}
+
+func (reader *maxSizeReader) Read(p []byte) (int, error) {
+	if reader.remaining < 0 {
+		return 0, tooLargeError(reader.limits)
+	}
+
+	// Read one byte more than allowed, so we can tell if the document ends exactly at the limit
+	if int64(len(p)) > reader.remaining+1 {
+		p = p[:reader.remaining+1]
+	}
+	n, err := reader.reader.Read(p)
+	reader.remaining -= int64(n)
+	if reader.remaining < 0 {
+		return n, tooLargeError(reader.limits)
+	}
+	return n, err
+}
@@ -0,0 +1,154 @@
+package report_downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+)
+
+const validatorStoreFileName = "validators.json"
+
+// How often the store is saved while downloading, so an interrupted run keeps most of what it learned
+const validatorStoreSaveInterval = 5 * time.Second
+
+// The values a server gave us to identify a version of a resource.
+type resourceValidators struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+func newResourceValidators(data *downloader.DownloadData) resourceValidators {
+	return resourceValidators{
+		URL:          data.URL,
+		ETag:         data.Header.Get("ETag"),
+		LastModified: data.Header.Get("Last-Modified"),
+	}
+}
+
+func (validators *resourceValidators) isEmpty() bool {
+	return validators.ETag == "" && validators.LastModified == ""
+}
+
+// What we know about a downloaded report from an earlier run.
+type storedReport struct {
+	resourceValidators
+	// The hash of the file when it was written, so we can tell if it has changed since
+	SHA256 string `json:"sha256,omitempty"`
+	// The ID of the report with the same content, if it was deduplicated
+	ContentDuplicateOf string `json:"content_duplicate_of,omitempty"`
+	// Where the content is, relative to the output directory, for reports deduplicated by reference,
+	// since they don't have a file of their own
+	ContentPath string `json:"content_path,omitempty"`
+}
+
+// Keeps the validators and content of every downloaded report between runs, keyed by report ID,
+// so we can ask the server if a document has changed since we downloaded it.
+type validatorStore struct {
+	path string
+
+	mu      sync.Mutex
+	entries map[string]storedReport
+	// Whether there are changes that haven't been saved yet, and when we last saved
+	dirty     bool
+	lastSaved time.Time
+}
+
+func newValidatorStore(outputDir string) *validatorStore {
+	return &validatorStore{
+		path:    filepath.Join(outputDir, validatorStoreFileName),
+		entries: make(map[string]storedReport),
+	}
+}
+
+// Loads the store from the output directory, or creates an empty one if there is none yet.
+func loadValidatorStore(outputDir string) (*validatorStore, error) {
+	store := newValidatorStore(outputDir)
+
+	storeBytes, err := os.ReadFile(store.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not read validator store: %w", err)
+	}
+
+	if err := json.Unmarshal(storeBytes, &store.entries); err != nil {
+		return nil, fmt.Errorf("could not parse validator store: %w", err)
+	}
+
+	return store, nil
+}
+
+func (store *validatorStore) get(id string) (storedReport, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	entry, ok := store.entries[id]
+	return entry, ok
+}
+
+func (store *validatorStore) set(id string, validators resourceValidators) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	entry := store.entries[id]
+	entry.resourceValidators = validators
+	store.entries[id] = entry
+	store.dirty = true
+}
+
+// Records where the content of the report is, and what it was when it was written.
+func (store *validatorStore) setContent(id string, sha256 string, duplicateOf string, contentPath string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	entry := store.entries[id]
+	entry.SHA256 = sha256
+	entry.ContentDuplicateOf = duplicateOf
+	entry.ContentPath = contentPath
+	if entry != store.entries[id] {
+		store.entries[id] = entry
+		store.dirty = true
+	}
+}
+
+// Saves the store if it has changed and it has been a while since the last save.
+func (store *validatorStore) saveIfDue() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if !store.dirty || time.Since(store.lastSaved) < validatorStoreSaveInterval {
+		return nil
+	}
+	return store.saveLocked()
+}
+
+func (store *validatorStore) save() error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.saveLocked()
+}
+
+// Writes the store next to the old one first, so a crash halfway through never leaves it broken.
+func (store *validatorStore) saveLocked() error {
+	storeBytes, err := json.MarshalIndent(store.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := store.path + ".tmp"
+	if err := os.WriteFile(tempPath, storeBytes, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, store.path); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	store.dirty = false
+	store.lastSaved = time.Now()
+	return nil
+}
@@ -0,0 +1,155 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Decides how many times, and how often, a single URL is retried before moving on to the next one.
+type RetryPolicy struct {
+	// Total number of attempts per URL, including the first one. Values below 1 are treated as 1.
+	MaxAttempts int
+	// The delay before the first retry. Each subsequent retry doubles it.
+	BaseDelay time.Duration
+	// The upper limit for any single delay, including delays requested by Retry-After.
+	MaxDelay time.Duration
+	// Fraction (0-1) of the delay that is randomly added or subtracted, so retries don't all line up.
+	Jitter float64
+	// HTTP status codes that are considered transient.
+	RetryableStatusCodes []int
+	// Retry on connection resets, timeouts, unexpected EOFs and the like.
+	RetryNetworkErrors bool
+	// Use the delay from the Retry-After header when the server provides one.
+	HonorRetryAfter bool
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   1 * time.Second,
+		MaxDelay:    30 * time.Second,
+		Jitter:      0.2,
+		RetryableStatusCodes: []int{
+			http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout,
+		},
+		RetryNetworkErrors: true,
+		HonorRetryAfter:    true,
+	}
+}
+
+func (policy *RetryPolicy) maxAttempts() int {
+	if policy.MaxAttempts < 1 {
+		return 1
+	}
+	return policy.MaxAttempts
+}
+
+func (policy *RetryPolicy) IsRetryableStatus(statusCode int) bool {
+	return slices.Contains(policy.RetryableStatusCodes, statusCode)
+}
+
+// Should the error from the given attempt be retried?
+func (policy *RetryPolicy) ShouldRetry(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return policy.IsRetryableStatus(statusErr.StatusCode)
+	}
+
+	return policy.RetryNetworkErrors && isNetworkError(err)
+}
+
+// Returns how long to wait before the next attempt.
+// attempt is the 1-based number of the attempt that just failed.
+func (policy *RetryPolicy) Delay(attempt int, err error) time.Duration {
+	var statusErr *StatusError
+	if policy.HonorRetryAfter && errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return policy.capDelay(statusErr.RetryAfter)
+	}
+
+	delay := policy.BaseDelay
+	// A MaxDelay of 0 means there is no cap, just like in capDelay.
+	// We still stop well before time.Duration overflows, leaving room for the jitter.
+	for i := 1; i < attempt && (policy.MaxDelay <= 0 || delay < policy.MaxDelay) && delay < math.MaxInt64/4; i++ {
+		delay *= 2
+	}
+
+	if policy.Jitter > 0 {
+		// Spread the delay evenly in the range delay +- (delay * jitter)
+		spread := (rand.Float64()*2 - 1) * policy.Jitter
+		delay += time.Duration(float64(delay) * spread)
+	}
+
+	return policy.capDelay(delay)
+}
+
+func (policy *RetryPolicy) capDelay(delay time.Duration) time.Duration {
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		return policy.MaxDelay
+	}
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Checks if the error was caused by the network rather than something like a malformed URL or a full disk.
+func isNetworkError(err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	// url.Error implements net.Error itself, so we need to look at what it wraps instead.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if errors.Is(urlErr.Err, io.EOF) {
+			return true
+		}
+		err = urlErr.Err
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Parses a Retry-After header, which is either a number of seconds or an HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		return date.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,23 @@
+package downloader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayWithoutLimitNeverOverflows(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: time.Second, Jitter: 0.5}
+
+	previous := time.Duration(0)
+	for attempt := 1; attempt <= 200; attempt++ {
+		delay := policy.Delay(attempt, nil)
+		if delay <= 0 {
+			t.Fatalf("attempt %d has delay %s", attempt, delay)
+		}
+		// The jitter can make a delay shorter than the one before, but never by that much
+		if delay < previous/4 {
+			t.Fatalf("attempt %d has delay %s, after %s", attempt, delay, previous)
+		}
+		previous = delay
+	}
+}
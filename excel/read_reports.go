@@ -4,30 +4,13 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/F0903/pdf_downloader_uge5/column_mapping"
 	"github.com/F0903/pdf_downloader_uge5/models"
 	"github.com/xuri/excelize/v2"
 )
 
-func createReportFromRow(row []string) *models.Report {
-	report := &models.Report{}
-	for colIndex, colCell := range row {
-		// Check if the column index maps to a column we want
-		switch ColumnMappings[colIndex] {
-		case IdColumn:
-			report.Id = colCell
-		case NameColumn:
-			report.Name = colCell
-		case PrimaryDownloadColumn:
-			report.PrimaryDownloadLink = colCell
-		case SecondaryDownloadColumn:
-			report.FallbackDownloadLink = colCell
-		}
-	}
-
-	return report
-}
-
-func ReadReports(path string) ([]*models.Report, error) {
+// Reads the reports from the first sheet, finding the mapped columns from the header row.
+func ReadReports(path string, mapping *column_mapping.ColumnMapping) ([]*models.Report, error) {
 	fmt.Printf("Reading excel spreadsheet '%s'...\n", path)
 	f, err := excelize.OpenFile(path)
 	if err != nil {
@@ -49,19 +32,36 @@ func ReadReports(path string) ([]*models.Report, error) {
 	}
 	defer rows.Close()
 
-	// We start by skipping the header row.
+	// The header row tells us where the mapped columns are.
 	if !rows.Next() {
 		return nil, errors.New("empty spreadsheet")
 	}
 
+	header, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get header row in spreadsheet!\n%w", err)
+	}
+
+	columns, err := mapping.Resolve(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map columns in spreadsheet!\n%w", err)
+	}
+
 	reports := make([]*models.Report, 0)
+	// The header was row 1
+	rowNumber := 1
 	for rows.Next() {
+		rowNumber++
 		row, err := rows.Columns()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get single row in spreadsheet!\n%w", err)
 		}
 
-		report := createReportFromRow(row)
+		report, err := columns.CreateReport(row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row %d in spreadsheet!\n%w", rowNumber, err)
+		}
+		report.SourceRow = rowNumber
 		reports = append(reports, report)
 	}
 
@@ -0,0 +1,127 @@
+package excel
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader/report_download_state"
+	"github.com/xuri/excelize/v2"
+)
+
+// The row colour categories of the Metadata sheet
+type rowKind int
+
+const (
+	rowPlain rowKind = iota
+	rowDone
+	rowFailed
+	rowMissing
+	rowCancelled
+)
+
+// The same colours Excel uses for its Good, Bad and Neutral cell styles
+var rowColours = map[rowKind]string{
+	rowDone:      "C6EFCE",
+	rowFailed:    "FFC7CE",
+	rowMissing:   "D9D9D9",
+	rowCancelled: "FFEB9C",
+}
+
+// Skipped and not modified reports are coloured as done, since we have a valid copy of them.
+// Dropped duplicates are grey like missing ones, since nothing was attempted.
+func rowKindOf(state *report_download_state.ReportDownloadState) rowKind {
+	switch {
+	case state.IsDone(), state.IsSkipped():
+		return rowDone
+	case state.IsFailed():
+		return rowFailed
+	case state.IsMissingURLs(), state.IsDroppedDuplicate():
+		return rowMissing
+	case state.IsCancelled():
+		return rowCancelled
+	}
+	return rowPlain
+}
+
+// The cell styles for each row kind, with and without hyperlink formatting.
+// Styles have to be created up front, since each one is stored in the workbook.
+type rowStyles struct {
+	plain map[rowKind]int
+	link  map[rowKind]int
+}
+
+func newRowStyles(f *excelize.File) (*rowStyles, error) {
+	styles := &rowStyles{
+		plain: make(map[rowKind]int),
+		link:  make(map[rowKind]int),
+	}
+
+	linkFont := &excelize.Font{Color: "0563C1", Underline: "single"}
+	for _, kind := range []rowKind{rowPlain, rowDone, rowFailed, rowMissing, rowCancelled} {
+		var fill excelize.Fill
+		if colour, ok := rowColours[kind]; ok {
+			fill = excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{colour}}
+		}
+
+		plain, err := f.NewStyle(&excelize.Style{Fill: fill})
+		if err != nil {
+			return nil, fmt.Errorf("could not create row style: %w", err)
+		}
+		link, err := f.NewStyle(&excelize.Style{Fill: fill, Font: linkFont})
+		if err != nil {
+			return nil, fmt.Errorf("could not create hyperlink style: %w", err)
+		}
+
+		styles.plain[kind] = plain
+		styles.link[kind] = link
+	}
+
+	return styles, nil
+}
+
+// Makes the cell a clickable link to target, if there is one.
+// Failing to do so isn't worth stopping for (Excel only allows 65530 links per sheet), so the cell just stays as text.
+func setHyperlink(f *excelize.File, sheet string, cell string, target string, style int) {
+	if target == "" {
+		return
+	}
+	if err := f.SetCellHyperLink(sheet, cell, target, "External"); err != nil {
+		return
+	}
+	f.SetCellStyle(sheet, cell, cell, style)
+}
+
+// Links to a local file by its path relative to the directory of the workbook, so the links still work if the directory is moved.
+func localFileLink(directory string, filePath string) string {
+	if filePath == "" {
+		return ""
+	}
+	relative, err := filepath.Rel(directory, filePath)
+	if err != nil {
+		return filepath.ToSlash(filePath)
+	}
+	return filepath.ToSlash(relative)
+}
+
+// Freezes the header row and adds an autofilter over all the columns, so the sheet can be sorted and filtered in Excel.
+func formatAsTable(f *excelize.File, sheet string, columnCount int, rowCount int) error {
+	err := f.SetPanes(sheet, &excelize.Panes{
+		Freeze:      true,
+		YSplit:      1,
+		TopLeftCell: "A2",
+		ActivePane:  "bottomLeft",
+	})
+	if err != nil {
+		return fmt.Errorf("could not freeze header row: %w", err)
+	}
+
+	lastCell, err := excelize.CoordinatesToCellName(columnCount, max(rowCount+1, 2))
+	if err != nil {
+		return fmt.Errorf("could not get last cell name: %w", err)
+	}
+	if err := f.AutoFilter(sheet, "A1:"+lastCell, nil); err != nil {
+		return fmt.Errorf("could not add autofilter: %w", err)
+	}
+
+	return nil
+}
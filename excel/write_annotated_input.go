@@ -0,0 +1,134 @@
+package excel
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/xuri/excelize/v2"
+)
+
+var annotationColumns = []interface{}{"DownloadState", "ErrorCode", "LocalPath", "SizeBytes", "SHA256", "Error", "DuplicateDecision"}
+
+// The copy is named after the input, so it's obvious which one it belongs to
+func annotatedInputPath(inputPath string, directory string) string {
+	extension := filepath.Ext(inputPath)
+	name := strings.TrimSuffix(filepath.Base(inputPath), extension)
+	return path.Join(directory, name+"_results"+extension)
+}
+
+// Finds the number of columns used by the sheet, so we can add ours after them.
+func usedColumnCount(f *excelize.File, sheet string) (int, error) {
+	rows, err := f.Rows(sheet)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		row, err := rows.Columns()
+		if err != nil {
+			return 0, err
+		}
+		count = max(count, len(row))
+	}
+	return count, nil
+}
+
+func annotationRow(result *report_downloader.ReportDownloadResult) []interface{} {
+	state := result.State
+
+	// Leave the size empty rather than 0 when we don't have the file
+	var size interface{}
+	if result.SHA256 != "" {
+		size = result.Size
+	}
+
+	errString := ""
+	if state.Err() != nil {
+		errString = strings.ReplaceAll(state.Err().Error(), "\n", ", ")
+	}
+
+	return []interface{}{
+		state.Name(),
+		string(state.ErrorCode()),
+		state.WrittenPath,
+		size,
+		result.SHA256,
+		errString,
+		result.AssociatedReport.DuplicateDecision,
+	}
+}
+
+// Writes a copy of the input spreadsheet to the directory, with the result of each report added to the end of the row it was read from.
+// Everything else in the workbook is left as it was.
+func WriteAnnotatedInput(inputPath string, results []*report_downloader.ReportDownloadResult, directory string) error {
+	fullOutputPath := annotatedInputPath(inputPath, directory)
+	fmt.Printf("Writing annotated copy of the input to '%s'...\n", fullOutputPath)
+
+	f, err := excelize.OpenFile(inputPath)
+	if err != nil {
+		return fmt.Errorf("could not open input spreadsheet: %w", err)
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			fmt.Printf("Could not close input spreadsheet!\n%v", err)
+		}
+	}()
+
+	// The reports are read from the first sheet
+	sheet := f.GetSheetName(0)
+	columnCount, err := usedColumnCount(f, sheet)
+	if err != nil {
+		return fmt.Errorf("could not read input spreadsheet: %w", err)
+	}
+
+	firstCell, err := excelize.CoordinatesToCellName(columnCount+1, 1)
+	if err != nil {
+		return fmt.Errorf("could not get cell name: %w", err)
+	}
+	if err := f.SetSheetRow(sheet, firstCell, &annotationColumns); err != nil {
+		return fmt.Errorf("could not write header: %w", err)
+	}
+
+	// Make our header cells look like the rest of the header
+	if columnCount > 0 {
+		lastHeaderCell, _ := excelize.CoordinatesToCellName(columnCount, 1)
+		lastCell, _ := excelize.CoordinatesToCellName(columnCount+len(annotationColumns), 1)
+		if style, err := f.GetCellStyle(sheet, lastHeaderCell); err == nil {
+			f.SetCellStyle(sheet, firstCell, lastCell, style)
+		}
+	}
+
+	linkStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Color: "0563C1", Underline: "single"}})
+	if err != nil {
+		return fmt.Errorf("could not create hyperlink style: %w", err)
+	}
+
+	for _, result := range results {
+		sourceRow := result.AssociatedReport.SourceRow
+		if sourceRow < 2 {
+			continue
+		}
+
+		cell, _ := excelize.CoordinatesToCellName(columnCount+1, sourceRow)
+		row := annotationRow(result)
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			f.SetCellValue(sheet, cell, fmt.Sprintf("Error when writing row: %v", err))
+			continue
+		}
+
+		// The LocalPath column
+		pathCell, _ := excelize.CoordinatesToCellName(columnCount+3, sourceRow)
+		setHyperlink(f, sheet, pathCell, localFileLink(directory, result.State.WrittenPath), linkStyle)
+	}
+
+	if err := f.SaveAs(fullOutputPath); err != nil {
+		return fmt.Errorf("could not save annotated copy of the input: %w", err)
+	}
+
+	return nil
+}
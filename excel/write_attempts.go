@@ -0,0 +1,104 @@
+package excel
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/xuri/excelize/v2"
+)
+
+const attemptsSheetName = "Attempts"
+
+const attemptTimeFormat = "2006-01-02 15:04:05.000"
+
+func setAttemptsSheetWidths(f *excelize.File) error {
+	// Set URL and FinalURL column widths
+	if err := f.SetColWidth(attemptsSheetName, "B", "B", 100); err != nil {
+		return fmt.Errorf("could not set sheet B column width: %w", err)
+	}
+	if err := f.SetColWidth(attemptsSheetName, "I", "I", 100); err != nil {
+		return fmt.Errorf("could not set sheet I column width: %w", err)
+	}
+
+	// Set StartTime and EndTime column widths
+	if err := f.SetColWidth(attemptsSheetName, "D", "E", 25); err != nil {
+		return fmt.Errorf("could not set sheet D-E column width: %w", err)
+	}
+
+	// Set ErrorCode and Error column widths
+	if err := f.SetColWidth(attemptsSheetName, "J", "J", 15); err != nil {
+		return fmt.Errorf("could not set sheet J column width: %w", err)
+	}
+	if err := f.SetColWidth(attemptsSheetName, "K", "K", 200); err != nil {
+		return fmt.Errorf("could not set sheet K column width: %w", err)
+	}
+
+	return nil
+}
+
+// Writes one row per request made, so it's possible to see exactly how each URL of a report fared.
+func writeAttemptsSheet(f *excelize.File, results []*report_downloader.ReportDownloadResult) error {
+	if _, err := f.NewSheet(attemptsSheetName); err != nil {
+		return fmt.Errorf("could not create sheet: %w", err)
+	}
+
+	columnNames := []interface{}{"ID", "URL", "Attempt", "StartTime", "EndTime", "DurationSeconds", "HTTPStatus", "BytesReceived", "FinalURL", "ErrorCode", "Error"}
+	if err := writeHeader(f, attemptsSheetName, columnNames); err != nil {
+		return fmt.Errorf("could not write header: %w", err)
+	}
+
+	if err := setAttemptsSheetWidths(f); err != nil {
+		return fmt.Errorf("could not set column widths: %w", err)
+	}
+
+	linkStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Color: "0563C1", Underline: "single"}})
+	if err != nil {
+		return fmt.Errorf("could not create hyperlink style: %w", err)
+	}
+
+	// Start at 2 because Excel starts counting at 1, and our header is already at A1
+	rowNumber := 2
+	for _, result := range results {
+		for _, attempt := range result.Attempts {
+			errString := ""
+			if attempt.Err != nil {
+				errString = strings.ReplaceAll(attempt.Err.Error(), "\n", ", ")
+			}
+
+			index := "A" + strconv.Itoa(rowNumber)
+			err := f.SetSheetRow(
+				attemptsSheetName,
+				index,
+				&[]interface{}{
+					result.AssociatedReport.Id,
+					attempt.URL,
+					attempt.Number,
+					attempt.StartTime.Format(attemptTimeFormat),
+					attempt.EndTime.Format(attemptTimeFormat),
+					attempt.Duration().Seconds(),
+					attempt.StatusCode,
+					attempt.BytesReceived,
+					attempt.FinalURL,
+					string(attempt.ErrorCode()),
+					errString,
+				},
+			)
+			if err != nil {
+				f.SetCellValue(attemptsSheetName, index, fmt.Sprintf("Error when writing row: %v", err))
+			}
+
+			row := strconv.Itoa(rowNumber)
+			setHyperlink(f, attemptsSheetName, "B"+row, attempt.URL, linkStyle)
+			setHyperlink(f, attemptsSheetName, "I"+row, attempt.FinalURL, linkStyle)
+			rowNumber++
+		}
+	}
+
+	if err := formatAsTable(f, attemptsSheetName, len(columnNames), rowNumber-2); err != nil {
+		return fmt.Errorf("could not format sheet: %w", err)
+	}
+
+	return nil
+}
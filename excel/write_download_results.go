@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"path"
 	"strconv"
+	"strings"
 
+	"github.com/F0903/pdf_downloader_uge5/downloader"
 	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
 	"github.com/xuri/excelize/v2"
 )
@@ -24,17 +26,57 @@ func setMainSheetWidths(f *excelize.File) error {
 		return fmt.Errorf("could not set sheet C-D column width: %w", err)
 	}
 
+	// Set LocalFile column width
+	err = f.SetColWidth(sheetName, "E", "E", 30)
+	if err != nil {
+		return fmt.Errorf("could not set sheet E column width: %w", err)
+	}
+
 	// Set DownloadState column width
-	err = f.SetColWidth(sheetName, "E", "E", 200)
+	err = f.SetColWidth(sheetName, "F", "F", 200)
+	if err != nil {
+		return fmt.Errorf("could not set sheet F column widths: %w", err)
+	}
+
+	// Set ErrorCode column width
+	err = f.SetColWidth(sheetName, "G", "G", 20)
+	if err != nil {
+		return fmt.Errorf("could not set sheet G column width: %w", err)
+	}
+
+	// Set Attempts column width
+	err = f.SetColWidth(sheetName, "H", "H", 10)
 	if err != nil {
-		return fmt.Errorf("could not set sheet E column widths: %w", err)
+		return fmt.Errorf("could not set sheet H column width: %w", err)
+	}
+
+	// Set URLErrors column width
+	err = f.SetColWidth(sheetName, "I", "I", 200)
+	if err != nil {
+		return fmt.Errorf("could not set sheet I column width: %w", err)
+	}
+
+	// Set DuplicateDecision column width
+	err = f.SetColWidth(sheetName, "J", "J", 80)
+	if err != nil {
+		return fmt.Errorf("could not set sheet J column width: %w", err)
+	}
+
+	// Set SHA256 and ContentDuplicateOf column widths
+	err = f.SetColWidth(sheetName, "K", "K", 70)
+	if err != nil {
+		return fmt.Errorf("could not set sheet K column width: %w", err)
+	}
+	err = f.SetColWidth(sheetName, "M", "M", 20)
+	if err != nil {
+		return fmt.Errorf("could not set sheet M column width: %w", err)
 	}
 
 	return nil
 }
 
-func writeHeader(f *excelize.File) error {
-	err := f.SetSheetRow(sheetName, "A1", &[]interface{}{"ID", "Name", "PrimaryDownloadURL", "FallbackDownloadURL", "DownloadState"})
+func writeHeader(f *excelize.File, sheet string, columnNames []interface{}) error {
+	err := f.SetSheetRow(sheet, "A1", &columnNames)
 	if err != nil {
 		return fmt.Errorf("could not set sheet row: %w", err)
 	}
@@ -44,7 +86,7 @@ func writeHeader(f *excelize.File) error {
 		return fmt.Errorf("could not create bold text style: %w", err)
 	}
 
-	err = f.SetRowStyle(sheetName, 1, 1, boldTextStyle)
+	err = f.SetRowStyle(sheet, 1, 1, boldTextStyle)
 	if err != nil {
 		return fmt.Errorf("could not set header row style: %w", err)
 	}
@@ -52,31 +94,62 @@ func writeHeader(f *excelize.File) error {
 	return nil
 }
 
-func writeResultsToRows(f *excelize.File, results []*report_downloader.ReportDownloadResult) {
+// One line per failed URL, with its error
+func formatURLErrors(result *report_downloader.ReportDownloadResult) string {
+	lines := make([]string, 0)
+	for _, urlError := range result.URLErrors() {
+		errString := strings.ReplaceAll(urlError.Err.Error(), "\n", ", ")
+		lines = append(lines, fmt.Sprintf("%s: [%s] %s", urlError.URL, downloader.ClassifyError(urlError.Err), errString))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func writeResultsToRows(f *excelize.File, results []*report_downloader.ReportDownloadResult, directory string, styles *rowStyles) {
 	for i, result := range results {
 		// We add 2 because Excel starts counting at 1, and our header is already at A1
-		index := "A" + strconv.Itoa(i+2)
+		row := strconv.Itoa(i + 2)
+		index := "A" + row
 		report := result.AssociatedReport
 		downloadState := result.State
+		localFile := localFileLink(directory, downloadState.WrittenPath)
 		err := f.SetSheetRow(
 			sheetName,
 			index,
 			&[]interface{}{
 				report.Id,
 				report.Name,
-				report.PrimaryDownloadLink,
-				report.FallbackDownloadLink,
+				strings.Join(report.DownloadLinks, "\n"),
+				result.SucceededURL(),
+				localFile,
 				downloadState.StringNoNewLines(),
+				string(downloadState.ErrorCode()),
+				result.AttemptCount(),
+				formatURLErrors(result),
+				report.DuplicateDecision,
+				result.SHA256,
+				result.Size,
+				result.ContentDuplicateOf,
+				result.BytesSaved,
 			},
 		)
 		if err != nil {
 			f.SetCellValue(sheetName, index, fmt.Sprintf("Error when writing row: %v", err))
 		}
+
+		kind := rowKindOf(downloadState)
+		f.SetCellStyle(sheetName, index, "N"+row, styles.plain[kind])
+
+		// A cell can only link to one place, so the DownloadURLs cell links to the first one
+		if len(report.DownloadLinks) > 0 {
+			setHyperlink(f, sheetName, "C"+row, report.DownloadLinks[0], styles.link[kind])
+		}
+		setHyperlink(f, sheetName, "D"+row, result.SucceededURL(), styles.link[kind])
+		setHyperlink(f, sheetName, "E"+row, localFile, styles.link[kind])
 	}
 }
 
-// Writes the download results to Excel spreadsheet.
-func WriteDownloadResults(results []*report_downloader.ReportDownloadResult, directory string) error {
+// Writes the download results, and the summary of the run, to Excel spreadsheet.
+func WriteDownloadResults(results []*report_downloader.ReportDownloadResult, summary *report_downloader.ReportSummary, directory string) error {
 	fullOutputPath := path.Join(directory, "metadata.xlsx")
 	fmt.Printf("Writing download result metadata to '%s'...\n", fullOutputPath)
 
@@ -92,7 +165,8 @@ func WriteDownloadResults(results []*report_downloader.ReportDownloadResult, dir
 		return fmt.Errorf("could not rename sheet on metadata spreadsheet: %w", err)
 	}
 
-	if err := writeHeader(f); err != nil {
+	mainColumns := []interface{}{"ID", "Name", "DownloadURLs", "SucceededURL", "LocalFile", "DownloadState", "ErrorCode", "Attempts", "URLErrors", "DuplicateDecision", "SHA256", "SizeBytes", "ContentDuplicateOf", "BytesSaved"}
+	if err := writeHeader(f, sheetName, mainColumns); err != nil {
 		return fmt.Errorf("could not write header: %w", err)
 	}
 
@@ -100,8 +174,25 @@ func WriteDownloadResults(results []*report_downloader.ReportDownloadResult, dir
 		return fmt.Errorf("could not set column widths: %w", err)
 	}
 
+	styles, err := newRowStyles(f)
+	if err != nil {
+		return err
+	}
+
 	// I don't think I need to comment this one
-	writeResultsToRows(f, results)
+	writeResultsToRows(f, results, directory, styles)
+
+	if err := formatAsTable(f, sheetName, len(mainColumns), len(results)); err != nil {
+		return fmt.Errorf("could not format sheet: %w", err)
+	}
+
+	if err := writeAttemptsSheet(f, results); err != nil {
+		return fmt.Errorf("could not write attempts sheet: %w", err)
+	}
+
+	if err := writeSummarySheet(f, summary); err != nil {
+		return fmt.Errorf("could not write summary sheet: %w", err)
+	}
 
 	if err := f.SaveAs(fullOutputPath); err != nil {
 		return fmt.Errorf("could not save download result metadata spreadsheet: %w", err)
@@ -0,0 +1,90 @@
+package excel
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/xuri/excelize/v2"
+)
+
+const summarySheetName = "Summary"
+
+// Writes the summary as a number of small tables below each other, each with their own header.
+type summaryWriter struct {
+	f         *excelize.File
+	boldStyle int
+	row       int
+}
+
+func (w *summaryWriter) writeRow(values ...interface{}) {
+	index := "A" + strconv.Itoa(w.row)
+	if err := w.f.SetSheetRow(summarySheetName, index, &values); err != nil {
+		w.f.SetCellValue(summarySheetName, index, fmt.Sprintf("Error when writing row: %v", err))
+	}
+	w.row++
+}
+
+func (w *summaryWriter) writeTableHeader(values ...interface{}) {
+	// Leave an empty row between the tables
+	if w.row > 1 {
+		w.row++
+	}
+	w.f.SetRowStyle(summarySheetName, w.row, w.row, w.boldStyle)
+	w.writeRow(values...)
+}
+
+func writeSummarySheet(f *excelize.File, summary *report_downloader.ReportSummary) error {
+	if _, err := f.NewSheet(summarySheetName); err != nil {
+		return fmt.Errorf("could not create sheet: %w", err)
+	}
+
+	if err := f.SetColWidth(summarySheetName, "A", "A", 30); err != nil {
+		return fmt.Errorf("could not set sheet A column width: %w", err)
+	}
+	if err := f.SetColWidth(summarySheetName, "B", "B", 100); err != nil {
+		return fmt.Errorf("could not set sheet B column width: %w", err)
+	}
+	if err := f.SetColWidth(summarySheetName, "C", "D", 15); err != nil {
+		return fmt.Errorf("could not set sheet C-D column width: %w", err)
+	}
+
+	boldStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return fmt.Errorf("could not create bold text style: %w", err)
+	}
+	w := &summaryWriter{f: f, boldStyle: boldStyle, row: 1}
+
+	w.writeTableHeader("Run", "")
+	w.writeRow("StartTime", summary.StartTime.Format(attemptTimeFormat))
+	w.writeRow("EndTime", summary.EndTime.Format(attemptTimeFormat))
+	w.writeRow("DurationSeconds", summary.Duration().Seconds())
+	w.writeRow("Reports", summary.TotalReports)
+	w.writeRow("ResumedReports", summary.ResumedReports)
+	w.writeRow("BytesReceived", summary.BytesReceived)
+	w.writeRow("BytesPerSecond", summary.Throughput())
+	w.writeRow("DedupedReports", summary.DedupedReports)
+	w.writeRow("BytesSaved", summary.BytesSaved)
+
+	w.writeTableHeader("DownloadState", "Count")
+	for _, state := range summary.States {
+		w.writeRow(state.Name, state.Count)
+	}
+
+	w.writeTableHeader("ErrorCode", "Count")
+	for _, code := range summary.ErrorCodes {
+		w.writeRow(code.Name, code.Count)
+	}
+
+	w.writeTableHeader("Host", "Requests", "Failures", "BytesReceived")
+	for _, host := range summary.Hosts {
+		w.writeRow(host.Host, host.Requests, host.Failures, host.BytesReceived)
+	}
+
+	w.writeTableHeader("SlowestDownloads", "URL", "DurationSeconds", "BytesReceived")
+	for _, slow := range summary.SlowestDownloads {
+		w.writeRow(slow.ReportId, slow.URL, slow.Duration.Seconds(), slow.BytesReceived)
+	}
+
+	return nil
+}
@@ -3,8 +3,12 @@ module github.com/F0903/pdf_downloader_uge5
 go 1.23.2
 
 require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/pdfcpu/pdfcpu v0.9.1
 	github.com/vbauerster/mpb/v8 v8.8.3
 	github.com/xuri/excelize/v2 v2.9.0
+	golang.org/x/text v0.19.0
+	gopkg.in/yaml.v2 v2.4.0
 )
 
 require (
@@ -14,7 +18,6 @@ require (
 	github.com/hhrutter/tiff v1.0.1 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
 	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
-	github.com/pdfcpu/pdfcpu v0.9.1 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/richardlehane/mscfb v1.0.4 // indirect
 	github.com/richardlehane/msoleps v1.0.4 // indirect
@@ -25,6 +28,4 @@ require (
 	golang.org/x/image v0.21.0 // indirect
 	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
-	golang.org/x/text v0.19.0 // indirect
-	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
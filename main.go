@@ -2,30 +2,81 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"time"
 
 	"github.com/F0903/pdf_downloader_uge5/args"
+	"github.com/F0903/pdf_downloader_uge5/downloader"
 	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
 	"github.com/F0903/pdf_downloader_uge5/excel"
+	"github.com/F0903/pdf_downloader_uge5/manifest"
+	"github.com/F0903/pdf_downloader_uge5/report_source"
+	"github.com/F0903/pdf_downloader_uge5/result_writer"
 	"github.com/F0903/pdf_downloader_uge5/utils"
 )
 
-func run() error {
-	argMap, err := args.ParseArgs()
+// Set with -ldflags "-X main.version=..." when building a release
+var version = "dev"
+
+func retryPolicyFromArgs(parsedArgs *args.Args) downloader.RetryPolicy {
+	policy := downloader.DefaultRetryPolicy()
+	policy.MaxAttempts = parsedArgs.MaxAttempts
+	policy.BaseDelay = parsedArgs.RetryDelay
+	policy.MaxDelay = parsedArgs.MaxRetryDelay
+	policy.Jitter = parsedArgs.RetryJitter
+	policy.RetryableStatusCodes = parsedArgs.RetryStatuses
+	return policy
+}
+
+func hostLimiterFromArgs(parsedArgs *args.Args) *downloader.HostLimiter {
+	limits := downloader.HostLimits{
+		MaxConnections: parsedArgs.HostConnections,
+		MinDelay:       parsedArgs.HostDelay,
+	}
+	return downloader.NewHostLimiter(limits, parsedArgs.HostLimits)
+}
+
+func reportSourceFromArgs(parsedArgs *args.Args) (report_source.ReportSource, error) {
+	delimiter, err := report_source.ParseDelimiter(parsedArgs.Delimiter)
 	if err != nil {
-		return fmt.Errorf("argument error: %w", err)
+		return nil, err
+	}
+
+	options := report_source.SourceOptions{
+		Delimiter: delimiter,
+		Encoding:  parsedArgs.Encoding,
+	}
+	return report_source.NewReportSource(parsedArgs.Format, parsedArgs.Input, options)
+}
+
+// Opens the journal, and if we are resuming, hands the reports that were completed in the earlier run to the downloader.
+func openJournal(parsedArgs *args.Args, reportDownloader *report_downloader.ReportDownloader) (*result_writer.Journal, error) {
+	journalPath := parsedArgs.Journal
+	if !filepath.IsAbs(journalPath) {
+		journalPath = filepath.Join(parsedArgs.OutputDir, journalPath)
 	}
 
-	// Check our required args are present
-	if err := args.AssertArgsPresent(argMap, []string{"input_data", "output_dir"}); err != nil {
-		return fmt.Errorf("missing args: %w", err)
+	if !parsedArgs.Resume {
+		return result_writer.NewJournal(journalPath)
+	}
+
+	completed, err := result_writer.LoadJournal(journalPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal of the earlier run!\n%w", err)
 	}
+	fmt.Printf("Resuming run, %d documents were completed in the earlier run.\n", len(completed))
+	reportDownloader.SetResumedResults(completed)
 
-	excelDataPath := argMap["input_data"].Value
-	outputDir := argMap["output_dir"].Value
+	return result_writer.OpenJournal(journalPath)
+}
+
+func run(parsedArgs *args.Args) error {
+	inputPath := parsedArgs.Input
+	outputDir := parsedArgs.OutputDir
 
 	// Create the output directory if it doesn’t exist
 	if err := os.MkdirAll(outputDir, os.ModePerm); err != nil {
@@ -34,42 +85,150 @@ func run() error {
 
 	startTime := time.Now()
 
-	reports, err := excel.ReadReports(excelDataPath)
+	source, err := reportSourceFromArgs(parsedArgs)
 	if err != nil {
-		return fmt.Errorf("failed to read Excel: \n%w", err)
+		return fmt.Errorf("argument error: %w", err)
+	}
+
+	parsedArgs.Columns.SetURLSeparator(parsedArgs.URLSeparator)
+	reports, err := source.ReadReports(inputPath, parsedArgs.Columns)
+	if err != nil {
+		return fmt.Errorf("failed to read reports: \n%w", err)
+	}
+
+	if err := report_downloader.ResolveDuplicateIds(reports, parsedArgs.DuplicateIds); err != nil {
+		return err
 	}
 
 	// Cancel downloads on CTRL+C
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer stop()
 
+	filename, err := report_downloader.ParseFilenameTemplate(parsedArgs.Filename)
+	if err != nil {
+		return fmt.Errorf("argument error: %w", err)
+	}
+
 	reportDownloader := report_downloader.NewReportDownloader(ctx, outputDir)
 	defer reportDownloader.Close()
+	reportDownloader.SetRetryPolicy(retryPolicyFromArgs(parsedArgs))
+	reportDownloader.SetConcurrency(parsedArgs.Concurrency)
+	reportDownloader.SetHostLimiter(hostLimiterFromArgs(parsedArgs))
+	reportDownloader.SetHeaders(parsedArgs.Headers)
+	reportDownloader.SetIncrementalMode(parsedArgs.Incremental)
+	reportDownloader.SetQuarantineDir(parsedArgs.QuarantineDir)
+	reportDownloader.SetFilenameTemplate(filename)
+	reportDownloader.SetDedupeMode(parsedArgs.Dedupe)
+	reportDownloader.SetSizeLimits(report_downloader.SizeLimits{
+		MinBytes: parsedArgs.MinSize,
+		MaxBytes: parsedArgs.MaxSize,
+	})
+
+	// Write each result as soon as it's done, so we don't lose everything if the program is killed
+	var journal *result_writer.Journal
+	if parsedArgs.Journal != "" {
+		journal, err = openJournal(parsedArgs, reportDownloader)
+		if err != nil {
+			return err
+		}
+		reportDownloader.SetResultHandler(journal.WriteResult)
+	}
 
 	results := reportDownloader.DownloadReports(reports)
 
+	if journal != nil {
+		if err := journal.Close(); err != nil {
+			fmt.Printf("The journal is incomplete!\n%v\n", err)
+		}
+	}
+	summary := report_downloader.SummarizeResults(results, startTime, time.Now())
+
 	// Write our metadata
-	err = excel.WriteDownloadResults(results, outputDir)
-	if err != nil {
-		return fmt.Errorf("failed to write download result metadata!\n%w", err)
+	for _, format := range parsedArgs.ResultFormats {
+		writer, err := result_writer.NewResultWriter(format)
+		if err != nil {
+			return err
+		}
+		if err := writer.WriteResults(results, summary, outputDir); err != nil {
+			return fmt.Errorf("failed to write download result metadata!\n%w", err)
+		}
 	}
 
-	endTime := time.Since(startTime)
+	if parsedArgs.AnnotateInput {
+		err = excel.WriteAnnotatedInput(inputPath, results, outputDir)
+		if err != nil {
+			return fmt.Errorf("failed to write annotated copy of the input!\n%w", err)
+		}
+	}
 
-	fmt.Printf("Downloaded %d documents.\n", report_downloader.CountSuccesfulReportDownloads(results))
-	fmt.Printf("Time taken: %s\n", endTime.Round(time.Second))
+	// Written last, so it covers the metadata as well
+	if _, err := manifest.WriteManifest(results, outputDir); err != nil {
+		return fmt.Errorf("failed to write checksum manifest!\n%w", err)
+	}
+
+	fmt.Println()
+	summary.Print(os.Stdout)
 
 	return nil
 }
 
+// Checks an output directory against its manifest, and returns the exit code.
+func runVerify(argStrings []string) int {
+	verifyArgs, err := args.ParseVerifyArgs(argStrings, os.Stdout)
+	if errors.Is(err, args.ErrorHelpRequested) {
+		return 0
+	}
+	if err != nil {
+		fmt.Printf("Argument error: %v\nRun with %s %s --help to see the usage.\n", err, os.Args[0], args.VerifyCommand)
+		return 2
+	}
+
+	result, err := manifest.Verify(verifyArgs.Directory)
+	if err != nil {
+		fmt.Printf("Error:\n %v\n", err)
+		return 2
+	}
+
+	result.Print(os.Stdout)
+	if !result.Ok() {
+		return 1
+	}
+	return 0
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == args.VerifyCommand {
+		os.Exit(runVerify(os.Args[2:]))
+	}
+
+	parsedArgs, err := args.ParseArgs(os.Args[1:], os.Stdout)
+	if errors.Is(err, args.ErrorHelpRequested) {
+		return
+	}
+	if err != nil {
+		fmt.Printf("Argument error: %v\nRun with --help to see the usage.\n", err)
+		os.Exit(2)
+	}
+
+	if parsedArgs.ShowVersion {
+		fmt.Printf("%s %s\n", os.Args[0], version)
+		return
+	}
+
+	if parsedArgs.PrintConfig {
+		parsedArgs.WriteEffectiveConfig(os.Stdout)
+		return
+	}
+
 	// We wrap all the stuff in the run() func so it's easier to
-	if err := run(); err != nil {
+	if err := run(parsedArgs); err != nil {
 		fmt.Printf("Error:\n %v\n", err)
 	} else {
 		fmt.Println("Done!")
 	}
 
-	fmt.Println("Press Enter to exit...")
-	utils.WaitForKey('\n')
+	if !parsedArgs.NoWait {
+		fmt.Println("Press Enter to exit...")
+		utils.WaitForKey('\n')
+	}
 }
@@ -0,0 +1,55 @@
+package manifest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The size of entries read from SHA256SUMS, which doesn't have them
+const unknownSize = -1
+
+// Paths with a newline or backslash are escaped the way sha256sum does it,
+// by escaping them and putting a backslash at the start of the line.
+var checksumPathEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r")
+var checksumPathUnescaper = strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r")
+
+func formatChecksumLine(sha256 string, path string) string {
+	escaped := checksumPathEscaper.Replace(path)
+	if escaped != path {
+		return "\\" + sha256 + "  " + escaped + "\n"
+	}
+	return sha256 + "  " + path + "\n"
+}
+
+// Parses a file in the format written by sha256sum, "<hash>  <path>" on each line.
+func parseChecksums(text string) (*Manifest, error) {
+	manifest := &Manifest{Files: make([]Entry, 0)}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			continue
+		}
+
+		escaped := strings.HasPrefix(line, "\\")
+		if escaped {
+			line = line[1:]
+		}
+
+		// The separator is two spaces, or a space and a * for files hashed in binary mode
+		sha256, path, ok := strings.Cut(line, " ")
+		if !ok || len(sha256) != 64 || path == "" || (path[0] != ' ' && path[0] != '*') {
+			return nil, fmt.Errorf("invalid line %d in %s: '%s'", i+1, ChecksumsFileName, line)
+		}
+		path = path[1:]
+		if escaped {
+			path = checksumPathUnescaper.Replace(path)
+		}
+
+		manifest.Files = append(manifest.Files, Entry{
+			Path:      path,
+			SHA256:    strings.ToLower(sha256),
+			SizeBytes: unknownSize,
+		})
+	}
+	return manifest, nil
+}
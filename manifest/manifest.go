@@ -0,0 +1,194 @@
+package manifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+// The names of the manifests in the output directory
+const (
+	ChecksumsFileName = "SHA256SUMS"
+	JsonFileName      = "manifest.json"
+)
+
+// A file in the output directory, with what we know about where it came from.
+type Entry struct {
+	// The path relative to the output directory, with / as separator
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	SizeBytes int64  `json:"size_bytes"`
+	// The report the file was downloaded for and the URL it came from, empty for files like the metadata
+	ReportId  string `json:"report_id,omitempty"`
+	SourceURL string `json:"source_url,omitempty"`
+}
+
+// Every file in the output directory at the end of a run.
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	Files     []Entry   `json:"files"`
+}
+
+// Leftovers of interrupted downloads and the manifests themselves are not part of the output,
+// since they are expected to change or disappear.
+func isIgnored(relativePath string) bool {
+	if relativePath == ChecksumsFileName || relativePath == JsonFileName {
+		return true
+	}
+	return strings.HasSuffix(relativePath, ".part") || strings.HasSuffix(relativePath, ".part.json")
+}
+
+// Walks the directory, and calls found with the relative path of every file that belongs in the manifest.
+// Symbolic links are followed to the file they point to, since that is the content we care about.
+func walkFiles(directory string, found func(relativePath string, fullPath string) error) error {
+	return filepath.WalkDir(directory, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+
+		relativePath, err := filepath.Rel(directory, fullPath)
+		if err != nil {
+			return err
+		}
+		relativePath = filepath.ToSlash(relativePath)
+		if isIgnored(relativePath) {
+			return nil
+		}
+
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, err := os.Stat(fullPath)
+			if err != nil {
+				return fmt.Errorf("could not follow link '%s': %w", relativePath, err)
+			}
+			if !info.Mode().IsRegular() {
+				return nil
+			}
+		} else if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		return found(relativePath, fullPath)
+	})
+}
+
+// Builds a manifest of every file in the directory.
+// Downloaded files were already hashed while they were written, so only the rest are read again.
+func Create(results []*report_downloader.ReportDownloadResult, directory string) (*Manifest, error) {
+	resultsByPath := make(map[string]*report_downloader.ReportDownloadResult)
+	for _, result := range results {
+		path := result.State.WrittenPath
+		if path == "" || result.SHA256 == "" {
+			continue
+		}
+		// With reference deduplication several reports share a file, and the first one downloaded it
+		key := filepath.Clean(path)
+		if _, ok := resultsByPath[key]; !ok {
+			resultsByPath[key] = result
+		}
+	}
+
+	manifest := &Manifest{CreatedAt: time.Now(), Files: make([]Entry, 0)}
+	err := walkFiles(directory, func(relativePath string, fullPath string) error {
+		entry := Entry{Path: relativePath}
+
+		result, known := resultsByPath[filepath.Clean(fullPath)]
+		if known {
+			entry.ReportId = result.AssociatedReport.Id
+			entry.SourceURL = result.SucceededURL()
+		}
+
+		// Only trust the hash we have if the file still has the size it was downloaded with
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return err
+		}
+		if known && info.Size() == result.Size {
+			entry.SHA256 = result.SHA256
+			entry.SizeBytes = result.Size
+		} else {
+			entry.SHA256, entry.SizeBytes, err = utils.HashFile(fullPath)
+			if err != nil {
+				return fmt.Errorf("could not hash '%s': %w", relativePath, err)
+			}
+		}
+
+		manifest.Files = append(manifest.Files, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(manifest.Files, func(a Entry, b Entry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return manifest, nil
+}
+
+// Writes the manifest as both a SHA256SUMS file, which can be checked with "sha256sum -c", and a manifest.json.
+func (manifest *Manifest) Write(directory string) error {
+	var checksums strings.Builder
+	for _, entry := range manifest.Files {
+		checksums.WriteString(formatChecksumLine(entry.SHA256, entry.Path))
+	}
+	if err := os.WriteFile(filepath.Join(directory, ChecksumsFileName), []byte(checksums.String()), 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", ChecksumsFileName, err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", JsonFileName, err)
+	}
+	if err := os.WriteFile(filepath.Join(directory, JsonFileName), data, 0644); err != nil {
+		return fmt.Errorf("could not write %s: %w", JsonFileName, err)
+	}
+
+	return nil
+}
+
+// Creates and writes the manifests of the output directory, after a run.
+func WriteManifest(results []*report_downloader.ReportDownloadResult, directory string) (*Manifest, error) {
+	manifest, err := Create(results, directory)
+	if err != nil {
+		return nil, err
+	}
+	if err := manifest.Write(directory); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Loads the manifest of the directory, from manifest.json if it's there, otherwise from SHA256SUMS.
+func Load(directory string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(directory, JsonFileName))
+	if err == nil {
+		manifest := &Manifest{}
+		if err := json.Unmarshal(data, manifest); err != nil {
+			return nil, fmt.Errorf("could not parse %s: %w", JsonFileName, err)
+		}
+		return manifest, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read %s: %w", JsonFileName, err)
+	}
+
+	data, err = os.ReadFile(filepath.Join(directory, ChecksumsFileName))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("there is no %s or %s in '%s'", JsonFileName, ChecksumsFileName, directory)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s: %w", ChecksumsFileName, err)
+	}
+	return parseChecksums(string(data))
+}
@@ -0,0 +1,133 @@
+package manifest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/F0903/pdf_downloader_uge5/utils"
+)
+
+// A file whose content doesn't match the manifest.
+type ModifiedFile struct {
+	Path           string
+	ExpectedSHA256 string
+	ActualSHA256   string
+	// -1 if the manifest doesn't have the size
+	ExpectedSize int64
+	ActualSize   int64
+}
+
+// The result of checking a directory against its manifest.
+type VerifyResult struct {
+	// The files that are in the manifest and match it
+	Verified int
+	// Files in the manifest that are no longer there
+	Missing []string
+	// Files that are there, but aren't the same as when the manifest was made
+	Modified []ModifiedFile
+	// Files that are there, but aren't in the manifest
+	Extra []string
+}
+
+func (result *VerifyResult) Ok() bool {
+	return len(result.Missing) == 0 && len(result.Modified) == 0 && len(result.Extra) == 0
+}
+
+func checkEntry(directory string, entry Entry, result *VerifyResult) error {
+	// The manifest might come from anywhere, so it can't make us read outside the directory
+	if !filepath.IsLocal(filepath.FromSlash(entry.Path)) {
+		return fmt.Errorf("the manifest has a path outside the directory: '%s'", entry.Path)
+	}
+	fullPath := filepath.Join(directory, filepath.FromSlash(entry.Path))
+
+	info, err := os.Stat(fullPath)
+	if os.IsNotExist(err) {
+		result.Missing = append(result.Missing, entry.Path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	modified := ModifiedFile{
+		Path:           entry.Path,
+		ExpectedSHA256: entry.SHA256,
+		ExpectedSize:   entry.SizeBytes,
+		ActualSize:     info.Size(),
+	}
+	// No need to read the whole file if the size already tells us it changed
+	if entry.SizeBytes != unknownSize && entry.SizeBytes != info.Size() {
+		result.Modified = append(result.Modified, modified)
+		return nil
+	}
+
+	modified.ActualSHA256, _, err = utils.HashFile(fullPath)
+	if err != nil {
+		return fmt.Errorf("could not hash '%s': %w", entry.Path, err)
+	}
+	if modified.ActualSHA256 != entry.SHA256 {
+		result.Modified = append(result.Modified, modified)
+		return nil
+	}
+
+	result.Verified++
+	return nil
+}
+
+// Checks every file in the directory against its manifest, and reports the files that are missing, modified or extra.
+// Returns an error only if the check itself couldn't be done.
+func Verify(directory string) (*VerifyResult, error) {
+	manifest, err := Load(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{
+		Missing:  make([]string, 0),
+		Modified: make([]ModifiedFile, 0),
+		Extra:    make([]string, 0),
+	}
+
+	inManifest := make(map[string]bool, len(manifest.Files))
+	for _, entry := range manifest.Files {
+		inManifest[entry.Path] = true
+		if err := checkEntry(directory, entry, result); err != nil {
+			return nil, err
+		}
+	}
+
+	err = walkFiles(directory, func(relativePath string, fullPath string) error {
+		if !inManifest[relativePath] {
+			result.Extra = append(result.Extra, relativePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not list the files in '%s': %w", directory, err)
+	}
+	slices.Sort(result.Extra)
+
+	return result, nil
+}
+
+// Prints the problems found, and how many files were fine.
+func (result *VerifyResult) Print(w io.Writer) {
+	for _, path := range result.Missing {
+		fmt.Fprintf(w, "MISSING:  %s\n", path)
+	}
+	for _, modified := range result.Modified {
+		if modified.ActualSHA256 == "" {
+			fmt.Fprintf(w, "MODIFIED: %s (size is %d bytes, expected %d)\n", modified.Path, modified.ActualSize, modified.ExpectedSize)
+		} else {
+			fmt.Fprintf(w, "MODIFIED: %s (SHA-256 is %s, expected %s)\n", modified.Path, modified.ActualSHA256, modified.ExpectedSHA256)
+		}
+	}
+	for _, path := range result.Extra {
+		fmt.Fprintf(w, "EXTRA:    %s\n", path)
+	}
+
+	fmt.Fprintf(w, "%d files verified, %d missing, %d modified, %d extra.\n", result.Verified, len(result.Missing), len(result.Modified), len(result.Extra))
+}
@@ -1,18 +1,28 @@
 package models
 
 type Report struct {
-	Id                   string
-	Name                 string
-	PrimaryDownloadLink  string
-	FallbackDownloadLink string
+	Id   string
+	Name string
+	// The publication year, if the input has it. Only used for naming files.
+	Year string
+	// Candidate URLs in order of importance. Each one is tried until one succeeds.
+	DownloadLinks []string
+	// The published SHA-256 hash (lower case hex) and size in bytes of the document, if the input has them.
+	// A download that doesn't match them is treated as failed.
+	ExpectedSHA256 string
+	ExpectedSize   int64
+	// The 1-based row of the spreadsheet or CSV file the report was read from, counting the header row.
+	// 0 for inputs that don't have rows, like JSON.
+	SourceRow int
+	// What was done about other reports with the same ID. Empty if the ID is unique.
+	DuplicateDecision string
+	// Set if the report isn't downloaded, because another report with the same ID is
+	DroppedAsDuplicate bool
 }
 
 // Implement Downloadable
 
 // Returns urls in order of importance
 func (report *Report) GetDownloadableURLs() []string {
-	return []string{
-		report.PrimaryDownloadLink,
-		report.FallbackDownloadLink,
-	}
+	return report.DownloadLinks
 }
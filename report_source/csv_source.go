@@ -0,0 +1,70 @@
+package report_source
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/F0903/pdf_downloader_uge5/column_mapping"
+	"github.com/F0903/pdf_downloader_uge5/models"
+	"golang.org/x/text/encoding"
+)
+
+// Reads reports from a CSV or TSV file with a header row.
+type CsvSource struct {
+	delimiter rune
+	decoder   *encoding.Decoder
+}
+
+func (source *CsvSource) ReadReports(path string, mapping *column_mapping.ColumnMapping) ([]*models.Report, error) {
+	fmt.Printf("Reading '%s'...\n", path)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file!\n%w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(source.decoder.Reader(file))
+	reader.Comma = source.delimiter
+	// Exports are rarely perfect, so be lenient about quotes and missing fields
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("empty file")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read header row!\n%w", err)
+	}
+
+	columns, err := mapping.Resolve(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map columns!\n%w", err)
+	}
+
+	reports := make([]*models.Report, 0)
+	// The header was row 1. Each record is a row, even if it spans several lines, just like when it's opened in Excel.
+	rowNumber := 1
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read row!\n%w", err)
+		}
+
+		rowNumber++
+		report, err := columns.CreateReport(row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read row %d!\n%w", rowNumber, err)
+		}
+		report.SourceRow = rowNumber
+		reports = append(reports, report)
+	}
+
+	fmt.Printf("Done reading '%s'\n", path)
+
+	return reports, nil
+}
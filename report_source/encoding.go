@@ -0,0 +1,37 @@
+package report_source
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Gets the decoder for the named text encoding.
+// The UTF decoders also strip the byte order mark if there is one.
+func getDecoder(name string) (*encoding.Decoder, error) {
+	switch strings.ToLower(strings.ReplaceAll(name, "_", "-")) {
+	case "", "utf-8", "utf8":
+		return unicode.UTF8BOM.NewDecoder(), nil
+	case "utf-16", "utf16":
+		// Uses the byte order mark, and falls back to little endian like Excel writes
+		return unicode.UTF16(unicode.LittleEndian, unicode.UseBOM).NewDecoder(), nil
+	case "utf-16le":
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM).NewDecoder(), nil
+	case "utf-16be":
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder(), nil
+	case "windows-1252", "cp1252":
+		return charmap.Windows1252.NewDecoder(), nil
+	case "iso-8859-1", "latin1", "latin-1":
+		return charmap.ISO8859_1.NewDecoder(), nil
+	}
+	return nil, fmt.Errorf("unsupported encoding '%s', must be one of utf-8, utf-16, utf-16le, utf-16be, windows-1252 or latin1", name)
+}
+
+// Checks that the encoding is one we support, so a typo is caught before we start reading.
+func ValidateEncoding(name string) error {
+	_, err := getDecoder(name)
+	return err
+}
@@ -0,0 +1,14 @@
+package report_source
+
+import (
+	"github.com/F0903/pdf_downloader_uge5/column_mapping"
+	"github.com/F0903/pdf_downloader_uge5/excel"
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+// Reads reports from the first sheet of an Excel spreadsheet.
+type ExcelSource struct{}
+
+func (source *ExcelSource) ReadReports(path string, mapping *column_mapping.ColumnMapping) ([]*models.Report, error) {
+	return excel.ReadReports(path, mapping)
+}
@@ -0,0 +1,150 @@
+package report_source
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/F0903/pdf_downloader_uge5/column_mapping"
+	"github.com/F0903/pdf_downloader_uge5/models"
+	"golang.org/x/text/encoding"
+)
+
+// Reads reports from JSON objects, either one per line (JSON Lines) or in a single JSON array.
+// The keys of the objects act as the header row.
+type JsonSource struct {
+	lines   bool
+	decoder *encoding.Decoder
+}
+
+type jsonObject = map[string]interface{}
+
+func (source *JsonSource) ReadReports(path string, mapping *column_mapping.ColumnMapping) ([]*models.Report, error) {
+	fmt.Printf("Reading '%s'...\n", path)
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file!\n%w", err)
+	}
+	defer file.Close()
+
+	reader := source.decoder.Reader(file)
+	var objects []jsonObject
+	if source.lines {
+		objects, err = readJsonLines(reader)
+	} else {
+		objects, err = readJsonArray(reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// An empty array is just as empty as a file without any lines
+	if len(objects) == 0 {
+		return nil, errors.New("empty file")
+	}
+
+	header := collectKeys(objects)
+	columns, err := mapping.ResolveNames(header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to map fields!\n%w", err)
+	}
+
+	reports := make([]*models.Report, 0, len(objects))
+	for index, object := range objects {
+		row := make([]string, len(header))
+		for i, key := range header {
+			row[i] = formatJsonValue(object[key])
+		}
+
+		report, err := columns.CreateReport(row)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read object %d!\n%w", index+1, err)
+		}
+		reports = append(reports, report)
+	}
+
+	fmt.Printf("Done reading '%s'\n", path)
+
+	return reports, nil
+}
+
+func newJsonDecoder(reader io.Reader) *json.Decoder {
+	decoder := json.NewDecoder(reader)
+	// Keep numbers as they were written, so IDs like 00123 or 1e5 aren't mangled
+	decoder.UseNumber()
+	return decoder
+}
+
+func readJsonArray(reader io.Reader) ([]jsonObject, error) {
+	objects := make([]jsonObject, 0)
+	if err := newJsonDecoder(reader).Decode(&objects); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON array of objects!\n%w", err)
+	}
+	return objects, nil
+}
+
+func readJsonLines(reader io.Reader) ([]jsonObject, error) {
+	objects := make([]jsonObject, 0)
+	scanner := bufio.NewScanner(reader)
+	// Lines can be a lot longer than the default 64KB limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		object := make(jsonObject)
+		if err := newJsonDecoder(bytes.NewReader(line)).Decode(&object); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON on line %d!\n%w", lineNumber, err)
+		}
+		objects = append(objects, object)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file!\n%w", err)
+	}
+
+	return objects, nil
+}
+
+// Collects every key used in any of the objects, in a stable order.
+func collectKeys(objects []jsonObject) []string {
+	seen := make(map[string]bool)
+	keys := make([]string, 0)
+	for _, object := range objects {
+		for key := range object {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func formatJsonValue(value interface{}) string {
+	switch typedValue := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typedValue
+	case json.Number:
+		return typedValue.String()
+	}
+
+	// Anything else, like nested objects, is kept as JSON
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(valueBytes)
+}
@@ -0,0 +1,42 @@
+package report_source
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/F0903/pdf_downloader_uge5/column_mapping"
+)
+
+func TestJsonWithDefaultMappingAndByteOrderMark(t *testing.T) {
+	inputs := map[string]string{
+		"reports.json":  "\xef\xbb\xbf" + `[{"id": "r1", "name": "Report", "primary": "https://example.com/r1.pdf", "fallback": ""}]`,
+		"reports.jsonl": "\xef\xbb\xbf" + `{"id": "r1", "name": "Report", "primary": "https://example.com/r1.pdf", "fallback": ""}` + "\n",
+	}
+
+	for name, content := range inputs {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			source, err := NewReportSource(FormatAuto, path, SourceOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			reports, err := source.ReadReports(path, column_mapping.DefaultColumnMapping())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(reports) != 1 || reports[0].Id != "r1" || reports[0].Name != "Report" {
+				t.Fatalf("expected report r1, got %+v", reports)
+			}
+			if !slices.Equal(reports[0].DownloadLinks, []string{"https://example.com/r1.pdf"}) {
+				t.Errorf("expected the primary URL, got %v", reports[0].DownloadLinks)
+			}
+		})
+	}
+}
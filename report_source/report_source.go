@@ -0,0 +1,117 @@
+package report_source
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/column_mapping"
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+// Something we can read reports from, like a spreadsheet or a CSV file.
+type ReportSource interface {
+	ReadReports(path string, mapping *column_mapping.ColumnMapping) ([]*models.Report, error)
+}
+
+type Format string
+
+const (
+	FormatAuto  Format = "auto"
+	FormatExcel Format = "xlsx"
+	FormatCSV   Format = "csv"
+	FormatTSV   Format = "tsv"
+	FormatJSONL Format = "jsonl"
+	FormatJSON  Format = "json"
+)
+
+var formats = []Format{FormatAuto, FormatExcel, FormatCSV, FormatTSV, FormatJSONL, FormatJSON}
+
+func ParseFormat(format string) (Format, error) {
+	for _, knownFormat := range formats {
+		if Format(strings.ToLower(format)) == knownFormat {
+			return knownFormat, nil
+		}
+	}
+	return FormatAuto, fmt.Errorf("unknown input format '%s', must be one of auto, xlsx, csv, tsv, jsonl or json", format)
+}
+
+// Picks the format from the file extension.
+func DetectFormat(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".xlsx", ".xlsm":
+		return FormatExcel, nil
+	case ".csv":
+		return FormatCSV, nil
+	case ".tsv", ".tab":
+		return FormatTSV, nil
+	case ".jsonl", ".ndjson":
+		return FormatJSONL, nil
+	case ".json":
+		return FormatJSON, nil
+	}
+	return FormatAuto, fmt.Errorf("can't tell the format of '%s' from its extension, please specify it", path)
+}
+
+// Parses a delimiter given on the command line. "tab" and "\t" are accepted for tabs, since they are hard to type.
+func ParseDelimiter(delimiter string) (rune, error) {
+	switch delimiter {
+	case "":
+		return 0, nil
+	case "tab", "\\t":
+		return '\t', nil
+	}
+
+	runes := []rune(delimiter)
+	if len(runes) != 1 {
+		return 0, fmt.Errorf("delimiter must be a single character, got '%s'", delimiter)
+	}
+	return runes[0], nil
+}
+
+// Options for the text based sources. The zero value uses the defaults of each format.
+type SourceOptions struct {
+	// The field delimiter for CSV and TSV. 0 means the default for the format.
+	Delimiter rune
+	// The text encoding for CSV, TSV and JSON, e.g. utf-8, utf-16 or windows-1252. Empty means utf-8.
+	Encoding string
+}
+
+// Creates the source for the format. FormatAuto picks the format from the extension of path.
+func NewReportSource(format Format, path string, options SourceOptions) (ReportSource, error) {
+	if format == FormatAuto {
+		detectedFormat, err := DetectFormat(path)
+		if err != nil {
+			return nil, err
+		}
+		format = detectedFormat
+	}
+
+	if format == FormatExcel {
+		return &ExcelSource{}, nil
+	}
+
+	// Every text format is decoded the same way, which also strips the byte order mark
+	decoder, err := getDecoder(options.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatCSV, FormatTSV:
+		delimiter := options.Delimiter
+		if delimiter == 0 {
+			delimiter = ','
+			if format == FormatTSV {
+				delimiter = '\t'
+			}
+		}
+		return &CsvSource{delimiter: delimiter, decoder: decoder}, nil
+	case FormatJSONL:
+		return &JsonSource{lines: true, decoder: decoder}, nil
+	case FormatJSON:
+		return &JsonSource{lines: false, decoder: decoder}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported input format '%s'", format)
+}
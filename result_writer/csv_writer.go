@@ -0,0 +1,101 @@
+package result_writer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+)
+
+var csvHeader = []string{
+	"id", "name", "year", "download_urls", "source_row", "duplicate_decision", "state", "error_code", "error", "succeeded_url", "local_path",
+	"size_bytes", "sha256", "expected_sha256", "expected_size", "content_duplicate_of", "bytes_saved", "start_time", "end_time", "duration_seconds", "attempt_count", "attempts",
+}
+
+// Writes one row per result. The attempts don't fit in a flat row, so they are written as a JSON array in the last column.
+type CsvWriter struct{}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// Reports without an expected size are left empty rather than 0
+func formatOptionalSize(size int64) string {
+	if size <= 0 {
+		return ""
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+func csvRow(record resultRecord) ([]string, error) {
+	attempts, err := json.Marshal(record.Attempts)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		record.Id,
+		record.Name,
+		record.Year,
+		strings.Join(record.DownloadURLs, "\n"),
+		strconv.Itoa(record.SourceRow),
+		record.DuplicateDecision,
+		record.State,
+		record.ErrorCode,
+		record.Error,
+		record.SucceededURL,
+		record.LocalPath,
+		strconv.FormatInt(record.SizeBytes, 10),
+		record.SHA256,
+		record.ExpectedSHA256,
+		formatOptionalSize(record.ExpectedSize),
+		record.ContentDuplicateOf,
+		strconv.FormatInt(record.BytesSaved, 10),
+		formatOptionalTime(record.StartTime),
+		formatOptionalTime(record.EndTime),
+		strconv.FormatFloat(record.DurationSeconds, 'f', -1, 64),
+		strconv.Itoa(record.AttemptCount),
+		string(attempts),
+	}, nil
+}
+
+func (writer *CsvWriter) WriteResults(results []*report_downloader.ReportDownloadResult, summary *report_downloader.ReportSummary, directory string) error {
+	fullOutputPath := path.Join(directory, fileName(FormatCSV))
+	fmt.Printf("Writing download result metadata to '%s'...\n", fullOutputPath)
+
+	file, err := os.Create(fullOutputPath)
+	if err != nil {
+		return fmt.Errorf("could not create file: %w", err)
+	}
+	defer file.Close()
+
+	csvWriter := csv.NewWriter(file)
+	if err := csvWriter.Write(csvHeader); err != nil {
+		return fmt.Errorf("could not write header: %w", err)
+	}
+
+	for _, result := range results {
+		row, err := csvRow(newResultRecord(result))
+		if err != nil {
+			return fmt.Errorf("could not encode attempts: %w", err)
+		}
+		if err := csvWriter.Write(row); err != nil {
+			return fmt.Errorf("could not write row: %w", err)
+		}
+	}
+
+	csvWriter.Flush()
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("could not write results: %w", err)
+	}
+	return file.Close()
+}
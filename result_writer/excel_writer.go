@@ -0,0 +1,13 @@
+package result_writer
+
+import (
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/F0903/pdf_downloader_uge5/excel"
+)
+
+// Writes the results to metadata.xlsx, along with the attempts and the summary.
+type ExcelWriter struct{}
+
+func (writer *ExcelWriter) WriteResults(results []*report_downloader.ReportDownloadResult, summary *report_downloader.ReportSummary, directory string) error {
+	return excel.WriteDownloadResults(results, summary, directory)
+}
@@ -0,0 +1,122 @@
+package result_writer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+)
+
+// The default name of the journal in the output directory
+const DefaultJournalName = "journal.jsonl"
+
+// Writes each result to a JSON Lines file as soon as it's done, so a run that crashes or is killed
+// still leaves a record of every report that finished.
+// Each line is in the same format as metadata.jsonl.
+type Journal struct {
+	file    *os.File
+	encoder *json.Encoder
+	// The first error we ran into. We stop writing after that, since the journal can't be trusted anymore.
+	err error
+}
+
+func newJournal(file *os.File) *Journal {
+	encoder := json.NewEncoder(file)
+	encoder.SetEscapeHTML(false)
+	return &Journal{file, encoder, nil}
+}
+
+// Creates a new journal, replacing any existing one.
+func NewJournal(path string) (*Journal, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not create journal: %w", err)
+	}
+	return newJournal(file), nil
+}
+
+// Opens an existing journal to add to it, or creates it if there is none.
+func OpenJournal(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open journal: %w", err)
+	}
+	return newJournal(file), nil
+}
+
+// Appends the result to the journal, and flushes it to disk.
+// Errors are saved and returned by Close, so this can be used directly as a result handler.
+func (journal *Journal) WriteResult(result *report_downloader.ReportDownloadResult) {
+	if journal.err != nil {
+		return
+	}
+
+	// The encoder writes each line in one go, so a crash can at most leave the last line cut short
+	if err := journal.encoder.Encode(newResultRecord(result)); err != nil {
+		journal.err = fmt.Errorf("could not write to journal: %w", err)
+		return
+	}
+	if err := journal.file.Sync(); err != nil {
+		journal.err = fmt.Errorf("could not flush journal: %w", err)
+	}
+}
+
+// Closes the journal, and returns the first error from writing to it, if any.
+func (journal *Journal) Close() error {
+	closeErr := journal.file.Close()
+	if journal.err != nil {
+		return journal.err
+	}
+	return closeErr
+}
+
+// Reads the journal of an earlier run, and returns the results of the reports that were completed in it.
+// If a report is in the journal more than once, the last line wins.
+// Lines that can't be read, like the last one if the program was killed while writing it, are skipped.
+// Returns no results if there is no journal.
+func LoadJournal(path string) ([]*report_downloader.ReportDownloadResult, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not open journal: %w", err)
+	}
+	defer file.Close()
+
+	records := make(map[string]resultRecord)
+	// Keep the order the reports were first seen in
+	ids := make([]string, 0)
+	reader := bufio.NewReader(file)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var record resultRecord
+			if err := json.Unmarshal(line, &record); err == nil {
+				if _, seen := records[record.Id]; !seen {
+					ids = append(ids, record.Id)
+				}
+				records[record.Id] = record
+			}
+		}
+
+		if errors.Is(readErr, io.EOF) {
+			break
+		} else if readErr != nil {
+			return nil, fmt.Errorf("could not read journal: %w", readErr)
+		}
+	}
+
+	results := make([]*report_downloader.ReportDownloadResult, 0, len(records))
+	for _, id := range ids {
+		if result, ok := records[id].toCompletedResult(); ok {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,59 @@
+package result_writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+)
+
+// Writes the results either as a single JSON array, or as JSON Lines with one result per line.
+type JsonWriter struct {
+	lines bool
+}
+
+func (writer *JsonWriter) WriteResults(results []*report_downloader.ReportDownloadResult, summary *report_downloader.ReportSummary, directory string) error {
+	format := FormatJSON
+	if writer.lines {
+		format = FormatJSONL
+	}
+	fullOutputPath := path.Join(directory, fileName(format))
+	fmt.Printf("Writing download result metadata to '%s'...\n", fullOutputPath)
+
+	file, err := os.Create(fullOutputPath)
+	if err != nil {
+		return fmt.Errorf("could not create file: %w", err)
+	}
+	defer file.Close()
+
+	buffered := bufio.NewWriter(file)
+	encoder := json.NewEncoder(buffered)
+	// URLs are full of & which would otherwise be escaped
+	encoder.SetEscapeHTML(false)
+
+	if writer.lines {
+		for _, result := range results {
+			if err := encoder.Encode(newResultRecord(result)); err != nil {
+				return fmt.Errorf("could not encode result: %w", err)
+			}
+		}
+	} else {
+		records := make([]resultRecord, 0, len(results))
+		for _, result := range results {
+			records = append(records, newResultRecord(result))
+		}
+
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(records); err != nil {
+			return fmt.Errorf("could not encode results: %w", err)
+		}
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return fmt.Errorf("could not write results: %w", err)
+	}
+	return file.Close()
+}
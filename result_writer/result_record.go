@@ -0,0 +1,173 @@
+package result_writer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader"
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader/report_download_state"
+	"github.com/F0903/pdf_downloader_uge5/models"
+)
+
+// A single request for a report, as it is serialized.
+type attemptRecord struct {
+	URL             string    `json:"url"`
+	Number          int       `json:"number"`
+	StartTime       time.Time `json:"start_time"`
+	EndTime         time.Time `json:"end_time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	HTTPStatus      int       `json:"http_status"`
+	BytesReceived   int64     `json:"bytes_received"`
+	FinalURL        string    `json:"final_url"`
+	ErrorCode       string    `json:"error_code"`
+	Error           string    `json:"error"`
+}
+
+// The result of a report, flattened into plain values so the text formats all agree on the fields.
+type resultRecord struct {
+	Id           string   `json:"id"`
+	Name         string   `json:"name"`
+	Year         string   `json:"year,omitempty"`
+	DownloadURLs []string `json:"download_urls"`
+	SourceRow    int      `json:"source_row,omitempty"`
+	// What was done about other reports with the same ID, if any
+	DuplicateDecision string `json:"duplicate_decision,omitempty"`
+	State             string `json:"state"`
+	ErrorCode         string `json:"error_code"`
+	Error             string `json:"error"`
+	SucceededURL      string `json:"succeeded_url"`
+	LocalPath         string `json:"local_path"`
+	SizeBytes         int64  `json:"size_bytes"`
+	SHA256            string `json:"sha256"`
+	// What the input said the hash and size should be, if anything
+	ExpectedSHA256 string `json:"expected_sha256,omitempty"`
+	ExpectedSize   int64  `json:"expected_size,omitempty"`
+	// The ID of the report with the same content this was deduplicated against
+	ContentDuplicateOf string `json:"content_duplicate_of,omitempty"`
+	BytesSaved         int64  `json:"bytes_saved"`
+	// Reports that never made a request don't have any timings
+	StartTime       *time.Time      `json:"start_time"`
+	EndTime         *time.Time      `json:"end_time"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	AttemptCount    int             `json:"attempt_count"`
+	Attempts        []attemptRecord `json:"attempts"`
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func newAttemptRecord(attempt *downloader.DownloadAttempt) attemptRecord {
+	return attemptRecord{
+		URL:             attempt.URL,
+		Number:          attempt.Number,
+		StartTime:       attempt.StartTime,
+		EndTime:         attempt.EndTime,
+		DurationSeconds: attempt.Duration().Seconds(),
+		HTTPStatus:      attempt.StatusCode,
+		BytesReceived:   attempt.BytesReceived,
+		FinalURL:        attempt.FinalURL,
+		ErrorCode:       string(attempt.ErrorCode()),
+		Error:           errorString(attempt.Err),
+	}
+}
+
+func newResultRecord(result *report_downloader.ReportDownloadResult) resultRecord {
+	report := result.AssociatedReport
+	state := result.State
+
+	record := resultRecord{
+		Id:                 report.Id,
+		Name:               report.Name,
+		Year:               report.Year,
+		DownloadURLs:       report.DownloadLinks,
+		SourceRow:          report.SourceRow,
+		DuplicateDecision:  report.DuplicateDecision,
+		State:              state.Name(),
+		ErrorCode:          string(state.ErrorCode()),
+		Error:              errorString(state.Err()),
+		SucceededURL:       result.SucceededURL(),
+		LocalPath:          state.WrittenPath,
+		SizeBytes:          result.Size,
+		SHA256:             result.SHA256,
+		ExpectedSHA256:     report.ExpectedSHA256,
+		ExpectedSize:       report.ExpectedSize,
+		ContentDuplicateOf: result.ContentDuplicateOf,
+		BytesSaved:         result.BytesSaved,
+		AttemptCount:       result.AttemptCount(),
+		Attempts:           make([]attemptRecord, 0, len(result.Attempts)),
+	}
+	// Make sure it's an empty list rather than null
+	if record.DownloadURLs == nil {
+		record.DownloadURLs = []string{}
+	}
+
+	if len(result.Attempts) > 0 {
+		startTime, endTime := result.StartTime(), result.EndTime()
+		record.StartTime = &startTime
+		record.EndTime = &endTime
+		record.DurationSeconds = result.Duration().Seconds()
+	}
+
+	for _, attempt := range result.Attempts {
+		record.Attempts = append(record.Attempts, newAttemptRecord(attempt))
+	}
+
+	return record
+}
+
+// Recreates an error from its message, keeping the code it was classified with.
+func recordError(code string, message string) error {
+	if message == "" {
+		return nil
+	}
+	return downloader.NewDownloadError(downloader.ErrorCode(code), errors.New(message))
+}
+
+func (record attemptRecord) toAttempt() *downloader.DownloadAttempt {
+	return &downloader.DownloadAttempt{
+		URL:           record.URL,
+		Number:        record.Number,
+		StartTime:     record.StartTime,
+		EndTime:       record.EndTime,
+		StatusCode:    record.HTTPStatus,
+		BytesReceived: record.BytesReceived,
+		FinalURL:      record.FinalURL,
+		Err:           recordError(record.ErrorCode, record.Error),
+	}
+}
+
+// Turns the record back into a result, if the report was completed.
+func (record resultRecord) toCompletedResult() (*report_downloader.ReportDownloadResult, bool) {
+	state, ok := report_download_state.ParseCompletedState(record.State, record.LocalPath)
+	if !ok {
+		return nil, false
+	}
+
+	report := &models.Report{
+		Id:                record.Id,
+		Name:              record.Name,
+		Year:              record.Year,
+		DownloadLinks:     record.DownloadURLs,
+		SourceRow:         record.SourceRow,
+		DuplicateDecision: record.DuplicateDecision,
+		ExpectedSHA256:    record.ExpectedSHA256,
+		ExpectedSize:      record.ExpectedSize,
+	}
+
+	attempts := make([]*downloader.DownloadAttempt, 0, len(record.Attempts))
+	for _, attempt := range record.Attempts {
+		attempts = append(attempts, attempt.toAttempt())
+	}
+
+	result := report_downloader.NewReportDownloadResult(report, state, attempts)
+	result.SHA256 = record.SHA256
+	result.Size = record.SizeBytes
+	result.ContentDuplicateOf = record.ContentDuplicateOf
+	result.BytesSaved = record.BytesSaved
+	return result, true
+}
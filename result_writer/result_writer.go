@@ -0,0 +1,53 @@
+package result_writer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/F0903/pdf_downloader_uge5/downloader/report_downloader"
+)
+
+// Something we can write the download results to, like a spreadsheet or a JSON file.
+type ResultWriter interface {
+	WriteResults(results []*report_downloader.ReportDownloadResult, summary *report_downloader.ReportSummary, directory string) error
+}
+
+type Format string
+
+const (
+	FormatExcel Format = "xlsx"
+	FormatJSON  Format = "json"
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+)
+
+var formats = []Format{FormatExcel, FormatJSON, FormatJSONL, FormatCSV}
+
+func ParseFormat(format string) (Format, error) {
+	for _, knownFormat := range formats {
+		if Format(strings.ToLower(format)) == knownFormat {
+			return knownFormat, nil
+		}
+	}
+	return "", fmt.Errorf("unknown result format '%s', must be one of xlsx, json, jsonl or csv", format)
+}
+
+// The name of the file the results are written to in the output directory
+func fileName(format Format) string {
+	return "metadata." + string(format)
+}
+
+func NewResultWriter(format Format) (ResultWriter, error) {
+	switch format {
+	case FormatExcel:
+		return &ExcelWriter{}, nil
+	case FormatJSON:
+		return &JsonWriter{lines: false}, nil
+	case FormatJSONL:
+		return &JsonWriter{lines: true}, nil
+	case FormatCSV:
+		return &CsvWriter{}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported result format '%s'", format)
+}
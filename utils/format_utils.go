@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Formats a byte count with a binary unit, like "1.5 MiB".
+func FormatBytes(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+var byteUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// Parses a size like "500", "20 KB" or "1.5 GiB" into bytes. KB, MB and GB are powers of 1000, and KiB, MiB and GiB powers of 1024.
+func ParseBytes(size string) (int64, error) {
+	size = strings.TrimSpace(size)
+	numberEnd := strings.IndexFunc(size, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if numberEnd < 0 {
+		numberEnd = len(size)
+	}
+
+	number, err := strconv.ParseFloat(size[:numberEnd], 64)
+	unit, knownUnit := byteUnits[strings.ToLower(strings.TrimSpace(size[numberEnd:]))]
+	if err != nil || !knownUnit || number < 0 {
+		return 0, fmt.Errorf("invalid size '%s', must be a number of bytes, optionally with a unit like KB, MB, GB, KiB, MiB or GiB", size)
+	}
+	return int64(number * float64(unit)), nil
+}
+
+// Formats a byte count so ParseBytes gives the same count back, using the largest binary unit it is a whole number of.
+func FormatBytesExact(bytes int64) string {
+	for _, unit := range []string{"GiB", "MiB", "KiB"} {
+		size := byteUnits[strings.ToLower(unit)]
+		if bytes != 0 && bytes%size == 0 {
+			return strconv.FormatInt(bytes/size, 10) + unit
+		}
+	}
+	return strconv.FormatInt(bytes, 10)
+}
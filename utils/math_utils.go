@@ -1,10 +0,0 @@
-package utils
-
-func IntPow(base, exp int) int {
-	result := 1
-	for exp > 0 {
-		result *= base
-		exp--
-	}
-	return result
-}